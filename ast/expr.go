@@ -18,6 +18,15 @@ type ExprVisitor[T any] interface {
 	VisitorExprAssign(*ExprAssign[T]) T
 	VisitorExprLogical(*ExprLogical[T]) T
 	VisitorExprCall(*ExprCall[T]) T
+	VisitorExprGet(*ExprGet[T]) T
+	VisitorExprSet(*ExprSet[T]) T
+	VisitorExprThis(*ExprThis[T]) T
+	VisitorExprSuper(*ExprSuper[T]) T
+	VisitorExprList(*ExprList[T]) T
+	VisitorExprIndex(*ExprIndex[T]) T
+	VisitorExprIndexSet(*ExprIndexSet[T]) T
+	VisitorExprMap(*ExprMap[T]) T
+	VisitorExprFunction(*ExprFunction[T]) T
 }
 
 type ExprCall[T any] struct {
@@ -30,8 +39,14 @@ func (e *ExprCall[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprCall(e)
 }
 
+func (e *ExprCall[T]) Span() token.Span {
+	return e.Callee.Span().To(e.Param.Span())
+}
+
 type Expr[T any] interface {
 	Accept(v ExprVisitor[T]) T
+	// Span returns the range of source the expression was parsed from.
+	Span() token.Span
 }
 
 type ExprBinary[T any] struct {
@@ -44,15 +59,26 @@ func (e *ExprBinary[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprBinary(e)
 }
 
+func (e *ExprBinary[T]) Span() token.Span {
+	return e.Left.Span().To(e.Right.Span())
+}
+
 type ExprGrouping[T any] struct {
+	Lparen     token.Token
 	Expression Expr[T]
+	Rparen     token.Token
 }
 
 func (e *ExprGrouping[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprGrouping(e)
 }
 
+func (e *ExprGrouping[T]) Span() token.Span {
+	return e.Lparen.Span().To(e.Rparen.Span())
+}
+
 type ExprLiteral[T any] struct {
+	Token token.Token
 	Value any
 }
 
@@ -60,6 +86,10 @@ func (e *ExprLiteral[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprLiteral(e)
 }
 
+func (e *ExprLiteral[T]) Span() token.Span {
+	return e.Token.Span()
+}
+
 type ExprUnary[T any] struct {
 	Token token.Token
 	Right Expr[T]
@@ -69,6 +99,10 @@ func (e *ExprUnary[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprUnary(e)
 }
 
+func (e *ExprUnary[T]) Span() token.Span {
+	return e.Token.Span().To(e.Right.Span())
+}
+
 type ExprVariable[T any] struct {
 	Name token.Token
 }
@@ -77,6 +111,10 @@ func (e *ExprVariable[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprVariable(e)
 }
 
+func (e *ExprVariable[T]) Span() token.Span {
+	return e.Name.Span()
+}
+
 type ExprAssign[T any] struct {
 	Name  token.Token
 	Value Expr[T]
@@ -86,6 +124,10 @@ func (e *ExprAssign[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprAssign(e)
 }
 
+func (e *ExprAssign[T]) Span() token.Span {
+	return e.Name.Span().To(e.Value.Span())
+}
+
 type ExprLogical[T any] struct {
 	Left     Expr[T]
 	Operator token.Token
@@ -95,3 +137,133 @@ type ExprLogical[T any] struct {
 func (e *ExprLogical[T]) Accept(v ExprVisitor[T]) T {
 	return v.VisitorExprLogical(e)
 }
+
+func (e *ExprLogical[T]) Span() token.Span {
+	return e.Left.Span().To(e.Right.Span())
+}
+
+type ExprGet[T any] struct {
+	Object Expr[T]
+	Name   token.Token
+}
+
+func (e *ExprGet[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprGet(e)
+}
+
+func (e *ExprGet[T]) Span() token.Span {
+	return e.Object.Span().To(e.Name.Span())
+}
+
+type ExprSet[T any] struct {
+	Object Expr[T]
+	Name   token.Token
+	Value  Expr[T]
+}
+
+func (e *ExprSet[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprSet(e)
+}
+
+func (e *ExprSet[T]) Span() token.Span {
+	return e.Object.Span().To(e.Value.Span())
+}
+
+type ExprThis[T any] struct {
+	Keyword token.Token
+}
+
+func (e *ExprThis[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprThis(e)
+}
+
+func (e *ExprThis[T]) Span() token.Span {
+	return e.Keyword.Span()
+}
+
+type ExprSuper[T any] struct {
+	Keyword token.Token
+	Method  token.Token
+}
+
+func (e *ExprSuper[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprSuper(e)
+}
+
+func (e *ExprSuper[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Method.Span())
+}
+
+type ExprList[T any] struct {
+	Lbracket token.Token
+	Elements []Expr[T]
+	Rbracket token.Token
+}
+
+func (e *ExprList[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprList(e)
+}
+
+func (e *ExprList[T]) Span() token.Span {
+	return e.Lbracket.Span().To(e.Rbracket.Span())
+}
+
+type ExprIndex[T any] struct {
+	Object   Expr[T]
+	Index    Expr[T]
+	Rbracket token.Token
+}
+
+func (e *ExprIndex[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprIndex(e)
+}
+
+func (e *ExprIndex[T]) Span() token.Span {
+	return e.Object.Span().To(e.Rbracket.Span())
+}
+
+type ExprIndexSet[T any] struct {
+	Object   Expr[T]
+	Index    Expr[T]
+	Rbracket token.Token
+	Value    Expr[T]
+}
+
+func (e *ExprIndexSet[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprIndexSet(e)
+}
+
+func (e *ExprIndexSet[T]) Span() token.Span {
+	return e.Object.Span().To(e.Value.Span())
+}
+
+type ExprMap[T any] struct {
+	Lbrace token.Token
+	Keys   []Expr[T]
+	Values []Expr[T]
+	Rbrace token.Token
+}
+
+func (e *ExprMap[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprMap(e)
+}
+
+func (e *ExprMap[T]) Span() token.Span {
+	return e.Lbrace.Span().To(e.Rbrace.Span())
+}
+
+// ExprFunction is an anonymous function. The arrow form "func (a) => a"
+// is parsed into a body that returns its expression.
+type ExprFunction[T any] struct {
+	Keyword token.Token
+	Params  []token.Token
+	Body    *StmtBlock[T]
+}
+
+func (e *ExprFunction[T]) Accept(v ExprVisitor[T]) T {
+	return v.VisitorExprFunction(e)
+}
+
+func (e *ExprFunction[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Body.Span())
+}
@@ -104,6 +104,59 @@ func (p printer) VisitorExprCall(e *ExprCall[string]) string {
 	return p.parenthesize(e.Param.Lexeme, append([]Expr[string]{e.Callee}, e.Arguments...)...)
 }
 
+func (p printer) VisitorExprGet(e *ExprGet[string]) string {
+	p.t.Helper()
+	return p.parenthesize("."+e.Name.Lexeme, e.Object)
+}
+
+func (p printer) VisitorExprSet(e *ExprSet[string]) string {
+	p.t.Helper()
+	return p.parenthesize("="+e.Name.Lexeme, e.Object, e.Value)
+}
+
+func (p printer) VisitorExprThis(e *ExprThis[string]) string {
+	p.t.Helper()
+	return p.parenthesize(e.Keyword.Lexeme)
+}
+
+func (p printer) VisitorExprSuper(e *ExprSuper[string]) string {
+	p.t.Helper()
+	return p.parenthesize(e.Keyword.Lexeme + "." + e.Method.Lexeme)
+}
+
+func (p printer) VisitorExprFunction(e *ExprFunction[string]) string {
+	p.t.Helper()
+	params := []string{}
+	for _, param := range e.Params {
+		params = append(params, param.Lexeme)
+	}
+	return "(func (" + strings.Join(params, " ") + ") ...)"
+}
+
+func (p printer) VisitorExprList(e *ExprList[string]) string {
+	p.t.Helper()
+	return p.parenthesize("list", e.Elements...)
+}
+
+func (p printer) VisitorExprIndex(e *ExprIndex[string]) string {
+	p.t.Helper()
+	return p.parenthesize("[]", e.Object, e.Index)
+}
+
+func (p printer) VisitorExprIndexSet(e *ExprIndexSet[string]) string {
+	p.t.Helper()
+	return p.parenthesize("[]=", e.Object, e.Index, e.Value)
+}
+
+func (p printer) VisitorExprMap(e *ExprMap[string]) string {
+	p.t.Helper()
+	entries := []Expr[string]{}
+	for i := range e.Keys {
+		entries = append(entries, e.Keys[i], e.Values[i])
+	}
+	return p.parenthesize("map", entries...)
+}
+
 func (p printer) parenthesize(name string, exprs ...Expr[string]) string {
 	p.t.Helper()
 	builder := &strings.Builder{}
@@ -0,0 +1,11 @@
+package ast
+
+// Loader finds and parses the modules named by import statements.
+type Loader interface {
+	// Resolve returns the file that path refers to when imported from the
+	// file importer, which is empty for the main script. Files returned
+	// for the same module must be equal, as they identify it.
+	Resolve(importer, path string) (file string, err error)
+	// Load returns the statements of file.
+	Load(file string) ([]Stmt[any], error)
+}
@@ -13,13 +13,24 @@ type StmtVisitor[T any] interface {
 	VisitorStmtWhile(*StmtWhile[T]) T
 	VisitorStmtFunction(*StmtFunction[T]) T
 	VisitorStmtReturn(*StmtReturn[T]) T
+	VisitorStmtClass(*StmtClass[T]) T
+	VisitorStmtThrow(*StmtThrow[T]) T
+	VisitorStmtTry(*StmtTry[T]) T
+	VisitorStmtBreak(*StmtBreak[T]) T
+	VisitorStmtContinue(*StmtContinue[T]) T
+	VisitorStmtForIn(*StmtForIn[T]) T
+	VisitorStmtImport(*StmtImport[T]) T
+	VisitorStmtExport(*StmtExport[T]) T
 }
 
 type Stmt[T any] interface {
 	Accept(v StmtVisitor[T]) T
+	// Span returns the range of source the statement was parsed from.
+	Span() token.Span
 }
 
 type StmtIf[T any] struct {
+	Keyword    token.Token
 	Condition  Expr[T]
 	ThenBranch Stmt[T]
 	ElseBranch Stmt[T]
@@ -29,7 +40,16 @@ func (e *StmtIf[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtIf(e)
 }
 
+func (e *StmtIf[T]) Span() token.Span {
+	span := e.Keyword.Span().To(e.ThenBranch.Span())
+	if e.ElseBranch != nil {
+		span = span.To(e.ElseBranch.Span())
+	}
+	return span
+}
+
 type StmtPrint[T any] struct {
+	Keyword    token.Token
 	Expression Expr[T]
 }
 
@@ -37,6 +57,10 @@ func (e *StmtPrint[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtPrint(e)
 }
 
+func (e *StmtPrint[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Expression.Span())
+}
+
 type StmtReturn[T any] struct {
 	Keyword token.Token
 	Value   Expr[T]
@@ -46,6 +70,13 @@ func (e *StmtReturn[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtReturn(e)
 }
 
+func (e *StmtReturn[T]) Span() token.Span {
+	if e.Value != nil {
+		return e.Keyword.Span().To(e.Value.Span())
+	}
+	return e.Keyword.Span()
+}
+
 type StmtExpr[T any] struct {
 	Expression Expr[T]
 }
@@ -54,14 +85,24 @@ func (e *StmtExpr[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtExpr(e)
 }
 
+func (e *StmtExpr[T]) Span() token.Span {
+	return e.Expression.Span()
+}
+
 type StmtBlock[T any] struct {
+	Lbrace     token.Token
 	Statements []Stmt[T]
+	Rbrace     token.Token
 }
 
 func (e *StmtBlock[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtBlock(e)
 }
 
+func (e *StmtBlock[T]) Span() token.Span {
+	return e.Lbrace.Span().To(e.Rbrace.Span())
+}
+
 type StmtVar[T any] struct {
 	Name        token.Token
 	Initializer Expr[T]
@@ -71,15 +112,30 @@ func (e *StmtVar[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtVar(e)
 }
 
+func (e *StmtVar[T]) Span() token.Span {
+	if e.Initializer != nil {
+		return e.Name.Span().To(e.Initializer.Span())
+	}
+	return e.Name.Span()
+}
+
 type StmtWhile[T any] struct {
+	Keyword   token.Token
 	Condition Expr[T]
 	Body      Stmt[T]
+	// Increment is evaluated after each iteration, including ones cut short
+	// by continue. It is only set by desugared for loops.
+	Increment Expr[T]
 }
 
 func (e *StmtWhile[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtWhile(e)
 }
 
+func (e *StmtWhile[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Body.Span())
+}
+
 type StmtFunction[T any] struct {
 	Name   token.Token
 	Params []token.Token
@@ -89,3 +145,133 @@ type StmtFunction[T any] struct {
 func (e *StmtFunction[T]) Accept(v StmtVisitor[T]) T {
 	return v.VisitorStmtFunction(e)
 }
+
+func (e *StmtFunction[T]) Span() token.Span {
+	return e.Name.Span().To(e.Body.Span())
+}
+
+type StmtClass[T any] struct {
+	Name       token.Token
+	Superclass *ExprVariable[T]
+	Methods    []*StmtFunction[T]
+}
+
+func (e *StmtClass[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtClass(e)
+}
+
+func (e *StmtClass[T]) Span() token.Span {
+	span := e.Name.Span()
+	if e.Superclass != nil {
+		span = span.To(e.Superclass.Span())
+	}
+	if len(e.Methods) > 0 {
+		span = span.To(e.Methods[len(e.Methods)-1].Span())
+	}
+	return span
+}
+
+type StmtThrow[T any] struct {
+	Keyword token.Token
+	Value   Expr[T]
+}
+
+func (e *StmtThrow[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtThrow(e)
+}
+
+func (e *StmtThrow[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Value.Span())
+}
+
+// StmtTry has a Catch block, a Finally block or both.
+type StmtTry[T any] struct {
+	Keyword token.Token
+	Body    *StmtBlock[T]
+	// Name is bound to the caught value inside Catch.
+	Name    token.Token
+	Catch   *StmtBlock[T]
+	Finally *StmtBlock[T]
+}
+
+func (e *StmtTry[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtTry(e)
+}
+
+func (e *StmtTry[T]) Span() token.Span {
+	if e.Finally != nil {
+		return e.Keyword.Span().To(e.Finally.Span())
+	}
+	return e.Keyword.Span().To(e.Catch.Span())
+}
+
+type StmtBreak[T any] struct {
+	Keyword token.Token
+}
+
+func (e *StmtBreak[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtBreak(e)
+}
+
+func (e *StmtBreak[T]) Span() token.Span {
+	return e.Keyword.Span()
+}
+
+type StmtContinue[T any] struct {
+	Keyword token.Token
+}
+
+func (e *StmtContinue[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtContinue(e)
+}
+
+func (e *StmtContinue[T]) Span() token.Span {
+	return e.Keyword.Span()
+}
+
+// StmtForIn runs Body once per element of Iterable, with Name bound to a
+// fresh variable on every iteration.
+type StmtForIn[T any] struct {
+	Keyword  token.Token
+	Name     token.Token
+	Iterable Expr[T]
+	Body     Stmt[T]
+}
+
+func (e *StmtForIn[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtForIn(e)
+}
+
+func (e *StmtForIn[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Body.Span())
+}
+
+// StmtImport binds the module found at Path to Name.
+type StmtImport[T any] struct {
+	Keyword token.Token
+	Path    token.Token
+	Name    token.Token
+}
+
+func (e *StmtImport[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtImport(e)
+}
+
+func (e *StmtImport[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Name.Span())
+}
+
+// StmtExport makes the name introduced by Declaration, a function, class
+// or variable declaration, visible to modules that import this one.
+type StmtExport[T any] struct {
+	Keyword     token.Token
+	Declaration Stmt[T]
+}
+
+func (e *StmtExport[T]) Accept(v StmtVisitor[T]) T {
+	return v.VisitorStmtExport(e)
+}
+
+func (e *StmtExport[T]) Span() token.Span {
+	return e.Keyword.Span().To(e.Declaration.Span())
+}
@@ -0,0 +1,141 @@
+package builtin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cndoit18/lox/limit"
+)
+
+func TestString(t *testing.T) {
+	cyclic := &List{Elements: []any{1.0}}
+	cyclic.Elements = append(cyclic.Elements, cyclic)
+	m := NewMap()
+	m.Put("a", "x")
+	m.Put(1.0, &List{Elements: []any{"1", 1.0}})
+	m.Put("self", m)
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{name: "empty list", value: &List{}, want: "[]"},
+		{name: "list containing itself", value: cyclic, want: "[1, [...]]"},
+		{name: "map", value: m, want: `{"a": "x", 1: ["1", 1], "self": {...}}`},
+		{name: "range", value: &Range{Start: 0, End: 1.5, Step: 0.5}, want: "range(0, 1.5, 0.5)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(tt.value); got != tt.want {
+				t.Errorf("String() = %s, want = %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	l := &List{Elements: []any{"a"}}
+	if _, err := l.Get(1.0); err == nil || err.Error() != "List index 1 out of range for length 1." {
+		t.Errorf("Get(1) error = %v", err)
+	}
+	if err := l.Set(0.5, nil); err == nil || err.Error() != "List index must be an integer." {
+		t.Errorf("Set(0.5) error = %v", err)
+	}
+	m := NewMap()
+	if err := m.Set(true, nil); err == nil || err.Error() != "Map keys must be strings or numbers." {
+		t.Errorf("Set(true) error = %v", err)
+	}
+	if _, err := m.Get("k"); err == nil || err.Error() != `Undefined key "k".` {
+		t.Errorf(`Get("k") error = %v`, err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	m := NewMap()
+	m.Put("b", 1.0)
+	m.Put("a", 2.0)
+	tests := []struct {
+		name  string
+		value any
+		want  []any
+	}{
+		{name: "list", value: &List{Elements: []any{1.0, "x"}}, want: []any{1.0, "x"}},
+		{name: "map keys", value: m, want: []any{"b", "a"}},
+		{name: "string", value: "hé", want: []any{"h", "é"}},
+		{name: "range", value: &Range{Start: 3, End: 0, Step: -1}, want: []any{3.0, 2.0, 1.0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok := Iterate(tt.value)
+			if !ok {
+				t.Fatalf("Iterate() ok = false")
+			}
+			got := []any{}
+			for value, ok := next(); ok; value, ok = next() {
+				got = append(got, value)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Iterate() = %v, want = %v", got, tt.want)
+			}
+		})
+	}
+	if _, ok := Iterate(1.0); ok {
+		t.Errorf("Iterate(1) ok = true")
+	}
+}
+
+func TestAllocated(t *testing.T) {
+	l := &List{}
+	before := Footprint(l, 1.0)
+	l.Elements = append(l.Elements, 1.0)
+	if got := Allocated(before, l, []any{l, 1.0}); got != limit.SlotSize {
+		t.Errorf("Allocated() of a list passed in = %d, want = %d", got, limit.SlotSize)
+	}
+	if got := Allocated(0, "abc", nil); got != 3 {
+		t.Errorf("Allocated() of a new string = %d, want = 3", got)
+	}
+}
+
+func TestEngine(t *testing.T) {
+	e := Engine{
+		TypeOf: func(any) string { return "" },
+		Equal:  func(a, b any) bool { return a == b },
+	}
+	natives := map[string]Func{}
+	e.Define(func(name string, arity int, fn Func) {
+		natives[name] = fn
+	}, nil)
+	tests := []struct {
+		name    string
+		native  string
+		args    []any
+		want    any
+		wantErr string
+	}{
+		{name: "typeof map", native: "typeof", args: []any{NewMap()}, want: "map"},
+		{name: "typeof unknown", native: "typeof", args: []any{struct{}{}}, want: "unknown"},
+		{name: "len string", native: "len", args: []any{"hé"}, want: 2.0},
+		{name: "len number", native: "len", args: []any{1.0}, wantErr: "Can't take the length of a value of type number."},
+		{name: "contains", native: "contains", args: []any{&List{Elements: []any{"a"}}, "a"}, want: true},
+		{name: "zero step", native: "range", args: []any{0.0, 1.0, 0.0}, wantErr: "range() step can't be zero."},
+		{name: "pop empty", native: "pop", args: []any{&List{}}, wantErr: "Can't pop from an empty list."},
+		{name: "has bad key", native: "has", args: []any{NewMap(), nil}, wantErr: "has() expects a string or number key but got a value of type nil."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := natives[tt.native](tt.args...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("%s() error = %v, wantErr = %s", tt.native, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s() error = %v", tt.native, err)
+			}
+			if got != tt.want {
+				t.Errorf("%s() = %v, want = %v", tt.native, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package builtin
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Variadic is the arity of a native function that accepts any number of arguments.
+const Variadic = -1
+
+// Func is the Go implementation of a native function. A non-nil error is
+// reported to the script as a runtime error at the call site.
+type Func func(args ...any) (any, error)
+
+// Engine describes the values of an engine to the standard natives.
+type Engine struct {
+	// TypeOf names the type of the engine's own values, its functions,
+	// classes, instances and modules, and returns "" for other values.
+	TypeOf func(value any) string
+	// Equal compares values as the == operator of the engine does.
+	Equal func(a, b any) bool
+}
+
+// Type names the type of value, as typeof() does.
+func (e Engine) Type(value any) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *List:
+		return "list"
+	case *Map:
+		return "map"
+	case *Range:
+		return "range"
+	}
+	if typ := e.TypeOf(value); typ != "" {
+		return typ
+	}
+	return "unknown"
+}
+
+// Describe names the type of value for error messages.
+func (e Engine) Describe(value any) string {
+	return "a value of type " + e.Type(value)
+}
+
+// Define registers the standard natives with define. input() reads lines
+// from stdin.
+func (e Engine) Define(define func(name string, arity int, fn Func), stdin *bufio.Reader) {
+	define("clock", 0, clock)
+	define("typeof", 1, func(args ...any) (any, error) {
+		return e.Type(args[0]), nil
+	})
+	define("len", 1, e.length)
+	define("str", 1, str)
+	define("num", 1, e.num)
+	define("range", Variadic, e.rangeOf)
+	define("push", 2, e.push)
+	define("pop", 1, e.pop)
+	define("insert", 3, e.insert)
+	define("slice", 3, e.slice)
+	define("contains", 2, e.contains)
+	define("has", 2, e.has)
+	define("delete", 2, e.remove)
+	define("keys", 1, e.keys)
+	define("values", 1, e.values)
+	define("input", 0, func(...any) (any, error) {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	})
+}
+
+func clock(...any) (any, error) {
+	return float64(time.Now().UnixNano()) / float64(time.Second), nil
+}
+
+func (e Engine) length(args ...any) (any, error) {
+	switch v := args[0].(type) {
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case *List:
+		return float64(len(v.Elements)), nil
+	case *Map:
+		return float64(len(v.keys)), nil
+	}
+	return nil, fmt.Errorf("Can't take the length of %s.", e.Describe(args[0]))
+}
+
+func str(args ...any) (any, error) {
+	return fmt.Sprint(args[0]), nil
+}
+
+func (e Engine) num(args ...any) (any, error) {
+	switch v := args[0].(type) {
+	case float64:
+		return v, nil
+	case string:
+		value, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Can't convert '%s' to a number.", v)
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("Can't convert %s to a number.", e.Describe(args[0]))
+}
+
+// rangeOf returns range(end), range(start, end) or range(start, end, step).
+func (e Engine) rangeOf(args ...any) (any, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, fmt.Errorf("range() expects 1 to 3 arguments but got %d.", len(args))
+	}
+	bounds := []float64{}
+	for _, arg := range args {
+		n, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("range() expects numbers but got %s.", e.Describe(arg))
+		}
+		bounds = append(bounds, n)
+	}
+	r := &Range{Step: 1}
+	switch len(bounds) {
+	case 1:
+		r.End = bounds[0]
+	case 2:
+		r.Start, r.End = bounds[0], bounds[1]
+	case 3:
+		r.Start, r.End, r.Step = bounds[0], bounds[1], bounds[2]
+	}
+	if r.Step == 0 {
+		return nil, errors.New("range() step can't be zero.")
+	}
+	return r, nil
+}
+
+func (e Engine) listArgument(name string, value any) (*List, error) {
+	list, ok := value.(*List)
+	if !ok {
+		return nil, fmt.Errorf("%s() expects a list but got %s.", name, e.Describe(value))
+	}
+	return list, nil
+}
+
+// position converts value to a whole number within [0, length].
+func position(name string, value any, length int) (int, error) {
+	n, ok := value.(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0, fmt.Errorf("%s() expects an integer index.", name)
+	}
+	if n < 0 || n > float64(length) {
+		return 0, fmt.Errorf("%s() index %v out of range for length %d.", name, n, length)
+	}
+	return int(n), nil
+}
+
+func (e Engine) push(args ...any) (any, error) {
+	list, err := e.listArgument("push", args[0])
+	if err != nil {
+		return nil, err
+	}
+	list.Elements = append(list.Elements, args[1])
+	return nil, nil
+}
+
+func (e Engine) pop(args ...any) (any, error) {
+	list, err := e.listArgument("pop", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Elements) == 0 {
+		return nil, errors.New("Can't pop from an empty list.")
+	}
+	last := list.Elements[len(list.Elements)-1]
+	list.Elements = list.Elements[:len(list.Elements)-1]
+	return last, nil
+}
+
+func (e Engine) insert(args ...any) (any, error) {
+	list, err := e.listArgument("insert", args[0])
+	if err != nil {
+		return nil, err
+	}
+	at, err := position("insert", args[1], len(list.Elements))
+	if err != nil {
+		return nil, err
+	}
+	list.Elements = append(list.Elements, nil)
+	copy(list.Elements[at+1:], list.Elements[at:])
+	list.Elements[at] = args[2]
+	return nil, nil
+}
+
+func (e Engine) slice(args ...any) (any, error) {
+	list, err := e.listArgument("slice", args[0])
+	if err != nil {
+		return nil, err
+	}
+	start, err := position("slice", args[1], len(list.Elements))
+	if err != nil {
+		return nil, err
+	}
+	end, err := position("slice", args[2], len(list.Elements))
+	if err != nil {
+		return nil, err
+	}
+	if start > end {
+		return nil, fmt.Errorf("slice() start %d is after end %d.", start, end)
+	}
+	return &List{Elements: append([]any{}, list.Elements[start:end]...)}, nil
+}
+
+func (e Engine) contains(args ...any) (any, error) {
+	list, err := e.listArgument("contains", args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, element := range list.Elements {
+		if e.Equal(element, args[1]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (e Engine) mapArgument(name string, value any) (*Map, error) {
+	m, ok := value.(*Map)
+	if !ok {
+		return nil, fmt.Errorf("%s() expects a map but got %s.", name, e.Describe(value))
+	}
+	return m, nil
+}
+
+func (e Engine) keyArgument(name string, value any) error {
+	if !IsKey(value) {
+		return fmt.Errorf("%s() expects a string or number key but got %s.", name, e.Describe(value))
+	}
+	return nil
+}
+
+func (e Engine) has(args ...any) (any, error) {
+	m, err := e.mapArgument("has", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := e.keyArgument("has", args[1]); err != nil {
+		return nil, err
+	}
+	_, ok := m.entries[args[1]]
+	return ok, nil
+}
+
+func (e Engine) remove(args ...any) (any, error) {
+	m, err := e.mapArgument("delete", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := e.keyArgument("delete", args[1]); err != nil {
+		return nil, err
+	}
+	return m.delete(args[1]), nil
+}
+
+func (e Engine) keys(args ...any) (any, error) {
+	m, err := e.mapArgument("keys", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return &List{Elements: append([]any{}, m.keys...)}, nil
+}
+
+func (e Engine) values(args ...any) (any, error) {
+	m, err := e.mapArgument("values", args[0])
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]any, 0, len(m.keys))
+	for _, key := range m.keys {
+		elements = append(elements, m.entries[key])
+	}
+	return &List{Elements: elements}, nil
+}
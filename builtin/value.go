@@ -0,0 +1,307 @@
+// Package builtin holds what the engines share about the values of
+// scripts: lists, maps and ranges, how they print and how much memory they
+// are charged, and the standard natives that work on them.
+package builtin
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cndoit18/lox/limit"
+)
+
+// List is a list value, created by list literals and natives.
+type List struct {
+	Elements []any
+}
+
+func (l *List) String() string {
+	return l.format(map[any]bool{})
+}
+
+// format prints l, or [...] if it is already being printed further out,
+// so that a list containing itself does not recurse forever.
+func (l *List) format(printing map[any]bool) string {
+	if printing[l] {
+		return "[...]"
+	}
+	printing[l] = true
+	defer delete(printing, l)
+	builder := &strings.Builder{}
+	builder.WriteByte('[')
+	for i, element := range l.Elements {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(nested(element, printing))
+	}
+	builder.WriteByte(']')
+	return builder.String()
+}
+
+// index checks that value is a whole number within [0, len(l.Elements))
+// and converts it.
+func (l *List) index(value any) (int, error) {
+	n, ok := value.(float64)
+	if !ok || n != math.Trunc(n) {
+		return 0, fmt.Errorf("List index must be an integer.")
+	}
+	if n < 0 || n >= float64(len(l.Elements)) {
+		return 0, fmt.Errorf("List index %v out of range for length %d.", n, len(l.Elements))
+	}
+	return int(n), nil
+}
+
+// Get returns the element at index.
+func (l *List) Get(index any) (any, error) {
+	n, err := l.index(index)
+	if err != nil {
+		return nil, err
+	}
+	return l.Elements[n], nil
+}
+
+// Set replaces the element at index.
+func (l *List) Set(index, value any) error {
+	n, err := l.index(index)
+	if err != nil {
+		return err
+	}
+	l.Elements[n] = value
+	return nil
+}
+
+// Map is a map value. It keeps its entries in insertion order, so printing
+// and keys() are deterministic.
+type Map struct {
+	entries map[any]any
+	keys    []any
+}
+
+// NewMap returns an empty map.
+func NewMap() *Map {
+	return &Map{entries: map[any]any{}}
+}
+
+func (m *Map) String() string {
+	return m.format(map[any]bool{})
+}
+
+// format prints m like List.format, or {...} if it is already being
+// printed further out.
+func (m *Map) format(printing map[any]bool) string {
+	if printing[m] {
+		return "{...}"
+	}
+	printing[m] = true
+	defer delete(printing, m)
+	builder := &strings.Builder{}
+	builder.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(Quote(key))
+		builder.WriteString(": ")
+		builder.WriteString(nested(m.entries[key], printing))
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+// IsKey reports whether key can be used as a map key.
+func IsKey(key any) bool {
+	switch key.(type) {
+	case string, float64:
+		return true
+	}
+	return false
+}
+
+// Len returns the number of entries in m.
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys of m in insertion order. The slice must not be
+// modified.
+func (m *Map) Keys() []any {
+	return m.keys
+}
+
+// Get returns the value stored under key.
+func (m *Map) Get(key any) (any, error) {
+	if !IsKey(key) {
+		return nil, fmt.Errorf("Map keys must be strings or numbers.")
+	}
+	value, ok := m.entries[key]
+	if !ok {
+		return nil, fmt.Errorf("Undefined key %s.", Quote(key))
+	}
+	return value, nil
+}
+
+// Set stores value under key.
+func (m *Map) Set(key, value any) error {
+	if !IsKey(key) {
+		return fmt.Errorf("Map keys must be strings or numbers.")
+	}
+	m.Put(key, value)
+	return nil
+}
+
+// Put stores value under key, which must satisfy IsKey.
+func (m *Map) Put(key, value any) {
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.entries[key] = value
+}
+
+func (m *Map) delete(key any) bool {
+	if _, ok := m.entries[key]; !ok {
+		return false
+	}
+	delete(m.entries, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Range is the lazy sequence of numbers produced by range().
+type Range struct {
+	Start, End, Step float64
+}
+
+func (r *Range) String() string {
+	return "range(" + strconv.FormatFloat(r.Start, 'f', -1, 64) + ", " +
+		strconv.FormatFloat(r.End, 'f', -1, 64) + ", " +
+		strconv.FormatFloat(r.Step, 'f', -1, 64) + ")"
+}
+
+// Iterate returns an iterator over the elements of a list, the keys of a
+// map, the characters of a string or the numbers of a range, and false for
+// other values. The iterator reports false once it is exhausted.
+func Iterate(value any) (func() (any, bool), bool) {
+	switch v := value.(type) {
+	case *List:
+		n := 0
+		return func() (any, bool) {
+			// the length is checked on every step, so elements pushed
+			// inside the loop are visited too.
+			if n >= len(v.Elements) {
+				return nil, false
+			}
+			n++
+			return v.Elements[n-1], true
+		}, true
+	case *Map:
+		return sequence(append([]any{}, v.keys...)), true
+	case string:
+		chars := []any{}
+		for _, c := range v {
+			chars = append(chars, string(c))
+		}
+		return sequence(chars), true
+	case *Range:
+		current := v.Start
+		return func() (any, bool) {
+			if (v.Step > 0 && current >= v.End) || (v.Step < 0 && current <= v.End) {
+				return nil, false
+			}
+			current += v.Step
+			return current - v.Step, true
+		}, true
+	}
+	return nil, false
+}
+
+func sequence(elements []any) func() (any, bool) {
+	n := 0
+	return func() (any, bool) {
+		if n >= len(elements) {
+			return nil, false
+		}
+		n++
+		return elements[n-1], true
+	}
+}
+
+// Instance is implemented by the instances of an engine's classes.
+type Instance interface {
+	ClassName() string
+	// Field returns the field called name, if the instance has one.
+	Field(name string) (any, bool)
+}
+
+// Uncaught describes value, raised by a throw statement that was never
+// caught.
+func Uncaught(value any) string {
+	if instance, ok := value.(Instance); ok {
+		if message, ok := instance.Field("message"); ok {
+			return "Uncaught " + instance.ClassName() + ": " + fmt.Sprint(message)
+		}
+	}
+	return "Uncaught exception: " + fmt.Sprint(value)
+}
+
+// Quote formats a value shown inside a container or a message, quoting
+// strings so that ["1"] and [1] print differently.
+func Quote(value any) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
+
+// nested quotes a value printed inside a container. printing holds the
+// containers being printed around it.
+func nested(value any, printing map[any]bool) string {
+	switch v := value.(type) {
+	case *List:
+		return v.format(printing)
+	case *Map:
+		return v.format(printing)
+	}
+	return Quote(value)
+}
+
+// Footprint approximates the memory held by values, without what their
+// elements refer to.
+func Footprint(values ...any) int {
+	size := 0
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			size += len(v)
+		case *List:
+			size += limit.ObjectSize + limit.SlotSize*len(v.Elements)
+		case *Map:
+			size += limit.ObjectSize + 2*limit.SlotSize*len(v.keys)
+		}
+	}
+	return size
+}
+
+// Allocated returns what a native called with args allocated, given the
+// Footprint of args before the call: the growth of the lists and maps
+// passed to it, and the string or collection it returned unless that was
+// passed to it too.
+func Allocated(before int, value any, args []any) int {
+	size := Footprint(args...) - before
+	switch value.(type) {
+	case *List, *Map:
+		for _, arg := range args {
+			if arg == value {
+				return size
+			}
+		}
+	}
+	return size + Footprint(value)
+}
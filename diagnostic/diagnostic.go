@@ -0,0 +1,74 @@
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cndoit18/lox/token"
+)
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return "error"
+}
+
+// Diagnostic is a message about a range of source.
+type Diagnostic struct {
+	Severity Severity
+	Span     token.Span
+	Message  string
+	// Notes are extra lines of context, such as a stack trace.
+	Notes []string
+}
+
+// String formats the diagnostic as "line:column: severity: message",
+// followed by one indented line per note.
+func (d Diagnostic) String() string {
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "%s: %s: %s", d.Span.Start, d.Severity, d.Message)
+	for _, note := range d.Notes {
+		builder.WriteString("\n\t")
+		builder.WriteString(note)
+	}
+	return builder.String()
+}
+
+// Diagnoser is implemented by errors that point at a range of source.
+type Diagnoser interface {
+	error
+	Diagnostic() Diagnostic
+}
+
+// Flatten returns the diagnostics carried by err, unwrapping joined errors.
+// Errors without a position are returned as diagnostics with a zero span.
+func Flatten(err error) []Diagnostic {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		diagnostics := []Diagnostic{}
+		for _, err := range joined.Unwrap() {
+			diagnostics = append(diagnostics, Flatten(err)...)
+		}
+		return diagnostics
+	}
+	var d Diagnoser
+	if errors.As(err, &d) {
+		return []Diagnostic{d.Diagnostic()}
+	}
+	return []Diagnostic{{Severity: Error, Message: err.Error()}}
+}
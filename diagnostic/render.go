@@ -0,0 +1,136 @@
+package diagnostic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorBlue   = "\x1b[34m"
+	colorCyan   = "\x1b[36m"
+	colorYellow = "\x1b[33m"
+)
+
+// Renderer prints diagnostics together with the source line they refer to:
+//
+//	error: Operands must be numbers.
+//	  --> script.l:3:7
+//	   |
+//	 3 | print "a" - 1;
+//	   |       ^^^^^^^
+//	   = in add() at 3:7
+type Renderer struct {
+	File   string
+	Source []byte
+	Color  bool
+}
+
+// Render writes every diagnostic carried by err to w.
+func (r *Renderer) Render(w io.Writer, err error) {
+	for _, d := range Flatten(err) {
+		r.RenderDiagnostic(w, d)
+	}
+}
+
+func (r *Renderer) RenderDiagnostic(w io.Writer, d Diagnostic) {
+	fmt.Fprintf(w, "%s%s\n", r.paint(severityColor(d.Severity)+colorBold, d.Severity.String()+":"), r.paint(colorBold, " "+d.Message))
+
+	start := d.Span.Start
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	if start.Line > 0 {
+		r.excerpt(w, gutter, d)
+	}
+	for _, note := range d.Notes {
+		fmt.Fprintf(w, "%s %s %s\n", gutter, r.paint(colorBlue, "="), note)
+	}
+}
+
+// excerpt writes the location of d and the source line it starts on, with
+// the span underlined.
+func (r *Renderer) excerpt(w io.Writer, gutter string, d Diagnostic) {
+	start := d.Span.Start
+	file := r.File
+	if file == "" {
+		file = "<input>"
+	}
+	fmt.Fprintf(w, "%s%s %s:%s\n", gutter, r.paint(colorBlue, "-->"), file, start)
+	line := r.line(start.Line)
+	if line == nil {
+		return
+	}
+
+	// the underline stops at the end of the first line of the span, and
+	// has a caret per character of it.
+	from, to := min(start.Column-1, len(line)), len(line)
+	if d.Span.End.Line == start.Line {
+		to = min(max(d.Span.End.Column-1, from), len(line))
+	}
+	width := max(utf8.RuneCount(line[from:to]), 1)
+
+	fmt.Fprintf(w, "%s %s\n", gutter, r.paint(colorBlue, "|"))
+	fmt.Fprintf(w, "%s %s %s\n", r.paint(colorBlue, strconv.Itoa(start.Line)), r.paint(colorBlue, "|"), line)
+	fmt.Fprintf(w, "%s %s %s%s\n", gutter, r.paint(colorBlue, "|"),
+		indent(line[:from]),
+		r.paint(severityColor(d.Severity)+colorBold, strings.Repeat("^", width)))
+}
+
+// line returns the 1-based line n of the source without its line break.
+func (r *Renderer) line(n int) []byte {
+	lines := bytes.Split(r.Source, []byte("\n"))
+	if n < 1 || n > len(lines) {
+		return nil
+	}
+	return bytes.TrimRight(lines[n-1], "\r")
+}
+
+func (r *Renderer) paint(color, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// indent replaces everything but tabs with spaces, so the caret lines up
+// with the source line above it.
+func indent(prefix []byte) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, string(prefix))
+}
+
+func severityColor(s Severity) string {
+	switch s {
+	case Warning:
+		return colorYellow
+	case Note:
+		return colorCyan
+	}
+	return colorRed
+}
+
+// IsTerminal reports whether w is a terminal that accepts colors.
+func IsTerminal(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
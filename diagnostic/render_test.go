@@ -0,0 +1,117 @@
+package diagnostic
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/cndoit18/lox/token"
+)
+
+type testError struct {
+	d Diagnostic
+}
+
+func (t *testError) Error() string {
+	return t.d.String()
+}
+
+func (t *testError) Diagnostic() Diagnostic {
+	return t.d
+}
+
+func TestRender(t *testing.T) {
+	source := []byte("var a = 1;\n\tprint \"x\" - a;\n")
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "caret",
+			err: &testError{Diagnostic{
+				Severity: Error,
+				Span: token.Span{
+					Start: token.Position{Offset: 18, Line: 2, Column: 8},
+					End:   token.Position{Offset: 21, Line: 2, Column: 11},
+				},
+				Message: "Operands must be numbers.",
+			}},
+			want: "error: Operands must be numbers.\n" +
+				" --> test.l:2:8\n" +
+				"  |\n" +
+				"2 | \tprint \"x\" - a;\n" +
+				"  | \t      ^^^\n",
+		},
+		{
+			name: "empty span",
+			err: &testError{Diagnostic{
+				Severity: Warning,
+				Span: token.Span{
+					Start: token.Position{Offset: 10, Line: 1, Column: 11},
+					End:   token.Position{Offset: 10, Line: 1, Column: 11},
+				},
+				Message: "Expect expression.",
+			}},
+			want: "warning: Expect expression.\n" +
+				" --> test.l:1:11\n" +
+				"  |\n" +
+				"1 | var a = 1;\n" +
+				"  |           ^\n",
+		},
+		{
+			name: "joined",
+			err: errors.Join(
+				&testError{Diagnostic{Span: token.Span{Start: token.Position{Line: 1, Column: 1}, End: token.Position{Line: 1, Column: 4}}, Message: "first"}},
+				errors.New("second"),
+			),
+			want: "error: first\n" +
+				" --> test.l:1:1\n" +
+				"  |\n" +
+				"1 | var a = 1;\n" +
+				"  | ^^^\n" +
+				"error: second\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &bytes.Buffer{}
+			r := &Renderer{File: "test.l", Source: source}
+			r.Render(got, tt.err)
+			if got.String() != tt.want {
+				t.Errorf("Render() got =\n%s\nwant =\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	d := Diagnostic{
+		Severity: Error,
+		Span:     token.Span{Start: token.Position{Line: 3, Column: 7}},
+		Message:  "Undefined variable 'a'.",
+	}
+	if got, want := d.String(), "3:7: error: Undefined variable 'a'."; got != want {
+		t.Errorf("String() got = %q, want = %q", got, want)
+	}
+}
+
+func TestRenderWideCharacters(t *testing.T) {
+	r := &Renderer{File: "test.l", Source: []byte("print \"héllo\" - 1;\n")}
+	got := &bytes.Buffer{}
+	r.RenderDiagnostic(got, Diagnostic{
+		Span: token.Span{
+			Start: token.Position{Offset: 6, Line: 1, Column: 7},
+			End:   token.Position{Offset: 14, Line: 1, Column: 15},
+		},
+		Message: "Operands must be numbers.",
+	})
+	want := "error: Operands must be numbers.\n" +
+		" --> test.l:1:7\n" +
+		"  |\n" +
+		"1 | print \"héllo\" - 1;\n" +
+		"  |       ^^^^^^^\n"
+	if got.String() != want {
+		t.Errorf("RenderDiagnostic() got = %q, want = %q", got.String(), want)
+	}
+}
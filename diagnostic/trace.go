@@ -0,0 +1,54 @@
+package diagnostic
+
+import (
+	"fmt"
+
+	"github.com/cndoit18/lox/token"
+)
+
+// Frame is an active function call, innermost first in a trace.
+type Frame struct {
+	Function string
+	// Pos is where execution was inside Function.
+	Pos token.Position
+}
+
+func (f Frame) String() string {
+	if f.Function == "" {
+		return "in script at " + f.Pos.String()
+	}
+	return "in " + f.Function + "() at " + f.Pos.String()
+}
+
+// Trace is the stack of calls that were active when a runtime error was
+// raised.
+type Trace []Frame
+
+// repeatedFrames is how many frames of a longer run of identical ones
+// traces show; the rest are counted.
+const repeatedFrames = 3
+
+// Notes returns a note per frame of t, for a Diagnostic.
+func (t Trace) Notes() []string {
+	notes := []string{}
+	for n := 0; n < len(t); {
+		// deep recursion leaves runs of identical frames, which are cut
+		// short.
+		same := 1
+		for n+same < len(t) && t[n+same] == t[n] {
+			same++
+		}
+		shown := same
+		if same > repeatedFrames+1 {
+			shown = repeatedFrames
+		}
+		for k := 0; k < shown; k++ {
+			notes = append(notes, t[n].String())
+		}
+		if shown < same {
+			notes = append(notes, fmt.Sprintf("... previous frame repeated %d more times", same-shown))
+		}
+		n += same
+	}
+	return notes
+}
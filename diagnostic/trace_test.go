@@ -0,0 +1,37 @@
+package diagnostic
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cndoit18/lox/token"
+)
+
+func TestTraceNotes(t *testing.T) {
+	f := Frame{Function: "f", Pos: token.Position{Line: 2, Column: 3}}
+	script := Frame{Pos: token.Position{Line: 5, Column: 1}}
+	tests := []struct {
+		name  string
+		trace Trace
+		want  []string
+	}{
+		{name: "empty", want: []string{}},
+		{
+			name:  "short run",
+			trace: Trace{f, f, f, f, script},
+			want:  []string{"in f() at 2:3", "in f() at 2:3", "in f() at 2:3", "in f() at 2:3", "in script at 5:1"},
+		},
+		{
+			name:  "long run",
+			trace: Trace{f, f, f, f, f, f, script},
+			want:  []string{"in f() at 2:3", "in f() at 2:3", "in f() at 2:3", "... previous frame repeated 3 more times", "in script at 5:1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.trace.Notes(); strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Notes() got = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/token"
+)
+
+// errorClass is the class of the values that catch clauses bind for
+// runtime errors.
+var errorClass = &loxClass{
+	name:    "Error",
+	methods: map[string]method{},
+}
+
+// method is a function declared in a class body. Calling it needs an
+// instance to bind "this" to.
+type method interface {
+	ast.Callable[any]
+	bind(instance *loxInstance) ast.Callable[any]
+}
+
+type loxClass struct {
+	name       string
+	superclass *loxClass
+	methods    map[string]method
+}
+
+func (c *loxClass) findMethod(name string) method {
+	if method, ok := c.methods[name]; ok {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.findMethod(name)
+	}
+	return nil
+}
+
+func (c *loxClass) Arity() int {
+	if initializer := c.findMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *loxClass) Call(v ast.ExprVisitor[any], params ...any) any {
+	instance := &loxInstance{
+		class:  c,
+		fields: map[string]any{},
+	}
+	if initializer := c.findMethod("init"); initializer != nil {
+		initializer.bind(instance).Call(v, params...)
+	}
+	return instance
+}
+
+func (c *loxClass) String() string {
+	return c.name
+}
+
+type loxInstance struct {
+	class  *loxClass
+	fields map[string]any
+}
+
+func (i *loxInstance) Get(name token.Token) any {
+	if v, ok := i.fields[name.Lexeme]; ok {
+		return v
+	}
+
+	if method := i.class.findMethod(name.Lexeme); method != nil {
+		return method.bind(i)
+	}
+
+	panic(newRuntimeError(name, "Undefined property '"+name.Lexeme+"'."))
+}
+
+// method returns the callable stored in field name, or the method of that
+// name bound to the instance.
+func (i *loxInstance) method(name string) (ast.Callable[any], bool) {
+	if v, ok := i.fields[name]; ok {
+		callable, ok := v.(ast.Callable[any])
+		return callable, ok
+	}
+	if method := i.class.findMethod(name); method != nil {
+		return method.bind(i), true
+	}
+	return nil, false
+}
+
+func (i *loxInstance) Set(name token.Token, val any) {
+	i.fields[name.Lexeme] = val
+}
+
+func (i *loxInstance) String() string {
+	return i.class.name + " instance"
+}
+
+func (i *loxInstance) ClassName() string {
+	return i.class.name
+}
+
+func (i *loxInstance) Field(name string) (any, bool) {
+	value, ok := i.fields[name]
+	return value, ok
+}
@@ -0,0 +1,744 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/limit"
+	"github.com/cndoit18/lox/token"
+)
+
+// WithClosureCompiler makes Run compile resolved statements into Go
+// closures before executing them, instead of walking the syntax tree. Each
+// node is visited once, with its variables already bound to slots, so
+// executing it skips the visitor dispatch and the lookups of the resolver's
+// results.
+func WithClosureCompiler() Option {
+	return func(e *evaluator) {
+		e.compiled = true
+	}
+}
+
+// exec runs a compiled statement in env. The value is the one returned
+// for completionReturn, and otherwise the value the tree walker gives the
+// statement.
+type exec func(env *environment) (completion, any)
+
+// eval evaluates a compiled expression in env.
+type eval func(env *environment) any
+
+// compiler turns resolved statements into closures. The closures create
+// environments exactly where the tree walker does, so the bindings of the
+// resolver hold for them too.
+type compiler struct {
+	i *evaluator
+	// depth counts the scopes around the code being compiled. Code at depth
+	// zero declares globals.
+	depth int
+}
+
+// compileAndRun compiles stmts and runs them in globals, returning the
+// value of the last statement.
+func (i *evaluator) compileAndRun(stmts []ast.Stmt[any], globals *globalEnvironment) (value any) {
+	c := &compiler{i: i}
+	env := &environment{globals: globals}
+	for _, stmt := range c.stmts(stmts) {
+		_, value = stmt(env)
+	}
+	if !endsInExpression(stmts) {
+		return nil
+	}
+	return value
+}
+
+func (c *compiler) stmts(stmts []ast.Stmt[any]) []exec {
+	code := make([]exec, 0, len(stmts))
+	for _, stmt := range stmts {
+		code = append(code, c.stmt(stmt))
+	}
+	return code
+}
+
+// execute runs code in order until a statement completes abruptly.
+func execute(code []exec, env *environment) (completion, any) {
+	for _, stmt := range code {
+		if c, value := stmt(env); c != completionNormal {
+			return c, value
+		}
+	}
+	return completionNormal, nil
+}
+
+// declarations counts the variables that stmts define in their scope, so
+// their environment is allocated at its final size.
+func declarations(stmts []ast.Stmt[any]) int {
+	n := 0
+	for _, stmt := range stmts {
+		if export, ok := stmt.(*ast.StmtExport[any]); ok {
+			stmt = export.Declaration
+		}
+		switch stmt.(type) {
+		case *ast.StmtVar[any], *ast.StmtFunction[any], *ast.StmtClass[any], *ast.StmtImport[any]:
+			n++
+		}
+	}
+	return n
+}
+
+// scope compiles stmts as the body of a scope nested in the current one.
+func (c *compiler) scope(stmts []ast.Stmt[any]) []exec {
+	c.depth++
+	defer func() { c.depth-- }()
+	return c.stmts(stmts)
+}
+
+// define returns the code storing a declared variable, which is either a
+// global or the next slot of the current environment. Only globals are
+// charged for, as in the tree walker.
+func (c *compiler) define(name token.Token) func(env *environment, value any) {
+	if c.depth == 0 {
+		return func(env *environment, value any) {
+			c.i.alloc(name, limit.SlotSize)
+			env.globals.Set(name, value)
+		}
+	}
+	return func(env *environment, value any) {
+		env.values = append(env.values, value)
+	}
+}
+
+func (c *compiler) stmt(s ast.Stmt[any]) exec {
+	switch s := s.(type) {
+	case *ast.StmtExpr[any]:
+		expr := c.expr(s.Expression)
+		return func(env *environment) (completion, any) {
+			return completionNormal, expr(env)
+		}
+	case *ast.StmtPrint[any]:
+		expr := c.expr(s.Expression)
+		return func(env *environment) (completion, any) {
+			fmt.Fprint(c.i.stdout, expr(env))
+			return completionNormal, nil
+		}
+	case *ast.StmtVar[any]:
+		define := c.define(s.Name)
+		if s.Initializer == nil {
+			return func(env *environment) (completion, any) {
+				define(env, nil)
+				return completionNormal, nil
+			}
+		}
+		initializer := c.expr(s.Initializer)
+		return func(env *environment) (completion, any) {
+			define(env, initializer(env))
+			return completionNormal, nil
+		}
+	case *ast.StmtBlock[any]:
+		return c.block(s)
+	case *ast.StmtIf[any]:
+		return c.ifStmt(s)
+	case *ast.StmtWhile[any]:
+		return c.while(s)
+	case *ast.StmtForIn[any]:
+		return c.forIn(s)
+	case *ast.StmtBreak[any]:
+		return func(*environment) (completion, any) {
+			return completionBreak, nil
+		}
+	case *ast.StmtContinue[any]:
+		return func(*environment) (completion, any) {
+			return completionContinue, nil
+		}
+	case *ast.StmtReturn[any]:
+		if s.Value == nil {
+			return func(*environment) (completion, any) {
+				return completionReturn, nil
+			}
+		}
+		value := c.expr(s.Value)
+		return func(env *environment) (completion, any) {
+			return completionReturn, value(env)
+		}
+	case *ast.StmtFunction[any]:
+		define := c.define(s.Name)
+		function := c.function(s.Name.Lexeme, s.Params, s.Body.(*ast.StmtBlock[any]))
+		return func(env *environment) (completion, any) {
+			c.i.alloc(s.Name, limit.ObjectSize)
+			define(env, function.closure(env))
+			return completionNormal, nil
+		}
+	case *ast.StmtClass[any]:
+		return c.class(s)
+	case *ast.StmtThrow[any]:
+		value := c.expr(s.Value)
+		return func(env *environment) (completion, any) {
+			panic(newThrowError(s.Keyword, value(env)))
+		}
+	case *ast.StmtTry[any]:
+		return c.try(s)
+	case *ast.StmtImport[any]:
+		define := c.define(s.Name)
+		return func(env *environment) (completion, any) {
+			define(env, c.i.importModule(s.Path))
+			return completionNormal, nil
+		}
+	case *ast.StmtExport[any]:
+		name := declaredName(s.Declaration).Lexeme
+		declaration := c.stmt(s.Declaration)
+		return func(env *environment) (completion, any) {
+			if n := len(c.i.importing); n > 0 {
+				c.i.importing[n-1].exports[name] = true
+			}
+			return declaration(env)
+		}
+	}
+	panic(fmt.Sprintf("unexpected statement %T", s))
+}
+
+func (c *compiler) block(s *ast.StmtBlock[any]) exec {
+	body, size := c.scope(s.Statements), declarations(s.Statements)
+	return func(env *environment) (completion, any) {
+		return execute(body, &environment{
+			enclosing: env,
+			globals:   env.globals,
+			values:    make([]any, 0, size),
+		})
+	}
+}
+
+func (c *compiler) ifStmt(s *ast.StmtIf[any]) exec {
+	condition, then := c.expr(s.Condition), c.stmt(s.ThenBranch)
+	if s.ElseBranch == nil {
+		return func(env *environment) (completion, any) {
+			if isTruthy(condition(env)) {
+				return then(env)
+			}
+			return completionNormal, nil
+		}
+	}
+	otherwise := c.stmt(s.ElseBranch)
+	return func(env *environment) (completion, any) {
+		if isTruthy(condition(env)) {
+			return then(env)
+		}
+		return otherwise(env)
+	}
+}
+
+func (c *compiler) while(s *ast.StmtWhile[any]) exec {
+	condition, body := c.expr(s.Condition), c.stmt(s.Body)
+	increment := func(*environment) any { return nil }
+	if s.Increment != nil {
+		increment = c.expr(s.Increment)
+	}
+	return func(env *environment) (completion, any) {
+		for isTruthy(condition(env)) {
+			switch result, value := body(env); result {
+			case completionBreak:
+				return completionNormal, nil
+			case completionReturn:
+				return result, value
+			}
+			increment(env)
+			c.i.step(s.Keyword)
+		}
+		return completionNormal, nil
+	}
+}
+
+func (c *compiler) forIn(s *ast.StmtForIn[any]) exec {
+	iterable := c.expr(s.Iterable)
+	c.depth++
+	body := c.stmt(s.Body)
+	c.depth--
+	return func(env *environment) (completion, any) {
+		next := c.i.iterate(s.Keyword, iterable(env))
+		for {
+			value, ok := next()
+			if !ok {
+				break
+			}
+			// every iteration gets its own variable, as in the tree walker.
+			iteration := &environment{enclosing: env, globals: env.globals, values: []any{value}}
+			switch result, value := body(iteration); result {
+			case completionBreak:
+				return completionNormal, nil
+			case completionReturn:
+				return result, value
+			}
+			c.i.step(s.Keyword)
+		}
+		return completionNormal, nil
+	}
+}
+
+func (c *compiler) try(s *ast.StmtTry[any]) exec {
+	body := c.block(s.Body)
+	var catch, finally []exec
+	if s.Catch != nil {
+		c.depth++
+		catch = c.stmts(s.Catch.Statements)
+		c.depth--
+	}
+	if s.Finally != nil {
+		finally = []exec{c.block(s.Finally)}
+	}
+	return func(env *environment) (result completion, value any) {
+		frames := len(c.i.frames)
+		if finally != nil {
+			defer func() {
+				r := recover()
+				if interrupted(r) {
+					panic(r)
+				}
+				c.i.unwind(r, frames)
+				// a finally block that returns or leaves a loop overrides
+				// the outcome of the try statement, errors included.
+				if how, v := execute(finally, env); how != completionNormal {
+					result, value = how, v
+				} else if r != nil {
+					panic(r)
+				}
+			}()
+		}
+		if catch != nil {
+			defer func() {
+				if r := recover(); r != nil {
+					err, ok := r.(*runtimeError)
+					if !ok || err.cause != nil {
+						panic(r)
+					}
+					// unwind the calls made inside the try block.
+					c.i.frames = c.i.frames[:frames]
+					result, value = execute(catch, &environment{
+						enclosing: env,
+						globals:   env.globals,
+						values:    []any{err.caught()},
+					})
+				}
+			}()
+		}
+		return body(env)
+	}
+}
+
+func (c *compiler) class(s *ast.StmtClass[any]) exec {
+	define := c.define(s.Name)
+	var superclass eval
+	if s.Superclass != nil {
+		superclass = c.expr(s.Superclass)
+		c.depth++
+		defer func() { c.depth-- }()
+	}
+	// methods are bound to "this" in a scope of its own.
+	c.depth++
+	methods := make([]*prototype, 0, len(s.Methods))
+	for _, method := range s.Methods {
+		function := c.function(method.Name.Lexeme, method.Params, method.Body.(*ast.StmtBlock[any]))
+		function.isInitializer = method.Name.Lexeme == "init"
+		methods = append(methods, function)
+	}
+	c.depth--
+	return func(env *environment) (completion, any) {
+		c.i.alloc(s.Name, limit.ObjectSize*(1+len(methods)))
+		var super *loxClass
+		closure := env
+		if superclass != nil {
+			class, ok := superclass(env).(*loxClass)
+			if !ok {
+				panic(newRuntimeError(s.Superclass.Name, "Superclass must be a class."))
+			}
+			super = class
+			closure = &environment{enclosing: env, globals: env.globals, values: []any{super}}
+		}
+		class := &loxClass{
+			name:       s.Name.Lexeme,
+			superclass: super,
+			methods:    make(map[string]method, len(methods)),
+		}
+		for _, method := range methods {
+			class.methods[method.name] = method.closure(closure)
+		}
+		define(env, class)
+		return completionNormal, nil
+	}
+}
+
+// prototype is a compiled function body, shared by the closures created
+// each time its declaration runs.
+type prototype struct {
+	name          string
+	arity         int
+	body          []exec
+	size          int
+	isInitializer bool
+}
+
+func (c *compiler) function(name string, params []token.Token, body *ast.StmtBlock[any]) *prototype {
+	return &prototype{
+		name:  name,
+		arity: len(params),
+		body:  c.scope(body.Statements),
+		size:  len(params) + declarations(body.Statements),
+	}
+}
+
+func (p *prototype) closure(env *environment) *compiledFunction {
+	return &compiledFunction{prototype: p, enclosing: env}
+}
+
+// compiledFunction is a function compiled by the closure compiler.
+type compiledFunction struct {
+	*prototype
+	enclosing *environment
+	// unbound and receiver are set for a method bound to an instance.
+	unbound  method
+	receiver *loxInstance
+}
+
+func (f *compiledFunction) Arity() int {
+	return f.arity
+}
+
+func (f *compiledFunction) Call(_ ast.ExprVisitor[any], params ...any) any {
+	values := make([]any, len(params), f.size)
+	copy(values, params)
+	result, value := execute(f.body, &environment{
+		enclosing: f.enclosing,
+		globals:   f.enclosing.globals,
+		values:    values,
+	})
+	if f.isInitializer {
+		return f.enclosing.values[0]
+	}
+	if result == completionReturn {
+		return value
+	}
+	return nil
+}
+
+func (f *compiledFunction) bind(instance *loxInstance) ast.Callable[any] {
+	bound := f.closure(&environment{
+		enclosing: f.enclosing,
+		globals:   f.enclosing.globals,
+		values:    []any{instance},
+	})
+	bound.unbound, bound.receiver = f, instance
+	return bound
+}
+
+func (f *compiledFunction) String() string {
+	return "<fn " + f.name + ">"
+}
+
+func (c *compiler) expr(e ast.Expr[any]) eval {
+	switch e := e.(type) {
+	case *ast.ExprLiteral[any]:
+		value := e.Value
+		return func(*environment) any { return value }
+	case *ast.ExprGrouping[any]:
+		return c.expr(e.Expression)
+	case *ast.ExprVariable[any]:
+		return c.variable(e.Name, e)
+	case *ast.ExprThis[any]:
+		return c.variable(e.Keyword, e)
+	case *ast.ExprAssign[any]:
+		return c.assign(e)
+	case *ast.ExprUnary[any]:
+		return c.unary(e)
+	case *ast.ExprBinary[any]:
+		return c.binary(e)
+	case *ast.ExprLogical[any]:
+		left, right := c.expr(e.Left), c.expr(e.Right)
+		if e.Operator.Type == token.OR {
+			return func(env *environment) any {
+				if left := left(env); isTruthy(left) {
+					return left
+				}
+				return right(env)
+			}
+		}
+		return func(env *environment) any {
+			if left := left(env); !isTruthy(left) {
+				return left
+			}
+			return right(env)
+		}
+	case *ast.ExprCall[any]:
+		return c.call(e)
+	case *ast.ExprGet[any]:
+		object := c.expr(e.Object)
+		return func(env *environment) any {
+			switch object := object(env).(type) {
+			case *loxInstance:
+				return object.Get(e.Name)
+			case *loxModule:
+				return object.Get(e.Name)
+			}
+			panic(newRuntimeError(e.Name, "Only instances have properties."))
+		}
+	case *ast.ExprSet[any]:
+		object, value := c.expr(e.Object), c.expr(e.Value)
+		return func(env *environment) any {
+			instance, ok := object(env).(*loxInstance)
+			if !ok {
+				panic(newRuntimeError(e.Name, "Only instances have fields."))
+			}
+			value := value(env)
+			if _, ok := instance.fields[e.Name.Lexeme]; !ok {
+				c.i.alloc(e.Name, 2*limit.SlotSize)
+			}
+			instance.Set(e.Name, value)
+			return value
+		}
+	case *ast.ExprSuper[any]:
+		distance := c.i.locals[e].depth
+		return func(env *environment) any {
+			superclass := env.GetAt(distance, 0, e.Keyword).(*loxClass)
+			object := env.GetAt(distance-1, 0, thisToken).(*loxInstance)
+			method := superclass.findMethod(e.Method.Lexeme)
+			if method == nil {
+				panic(newRuntimeError(e.Method, "Undefined property '"+e.Method.Lexeme+"'."))
+			}
+			return method.bind(object)
+		}
+	case *ast.ExprFunction[any]:
+		function := c.function(lambdaName, e.Params, e.Body)
+		return func(env *environment) any {
+			c.i.alloc(e.Keyword, limit.ObjectSize)
+			return function.closure(env)
+		}
+	case *ast.ExprList[any]:
+		elements := c.exprs(e.Elements)
+		return func(env *environment) any {
+			values := make([]any, 0, len(elements))
+			for _, element := range elements {
+				values = append(values, element(env))
+			}
+			c.i.alloc(e.Lbracket, limit.ObjectSize+limit.SlotSize*len(values))
+			return &builtin.List{Elements: values}
+		}
+	case *ast.ExprMap[any]:
+		keys, values := c.exprs(e.Keys), c.exprs(e.Values)
+		return func(env *environment) any {
+			m := builtin.NewMap()
+			for n, key := range keys {
+				k := key(env)
+				if !builtin.IsKey(k) {
+					panic(newRuntimeError(e.Lbrace, "Map keys must be strings or numbers."))
+				}
+				m.Put(k, values[n](env))
+			}
+			c.i.alloc(e.Lbrace, builtin.Footprint(m))
+			return m
+		}
+	case *ast.ExprIndex[any]:
+		object, index := c.expr(e.Object), c.expr(e.Index)
+		return func(env *environment) any {
+			object, index := object(env), index(env)
+			return getIndex(e.Rbracket, object, index)
+		}
+	case *ast.ExprIndexSet[any]:
+		object, index, value := c.expr(e.Object), c.expr(e.Index), c.expr(e.Value)
+		return func(env *environment) any {
+			object, index := object(env), index(env)
+			container, ok := object.(interface {
+				Set(any, any) error
+			})
+			if !ok {
+				panic(newRuntimeError(e.Rbracket, "Only lists and maps can be indexed."))
+			}
+			value := value(env)
+			before := builtin.Footprint(object)
+			if err := container.Set(index, value); err != nil {
+				panic(newRuntimeError(e.Rbracket, err.Error()))
+			}
+			if grown := builtin.Footprint(object) - before; grown > 0 {
+				c.i.alloc(e.Rbracket, grown)
+			}
+			return value
+		}
+	}
+	panic(fmt.Sprintf("unexpected expression %T", e))
+}
+
+func (c *compiler) exprs(exprs []ast.Expr[any]) []eval {
+	code := make([]eval, 0, len(exprs))
+	for _, expr := range exprs {
+		code = append(code, c.expr(expr))
+	}
+	return code
+}
+
+func (c *compiler) variable(name token.Token, e ast.Expr[any]) eval {
+	b, ok := c.i.locals[e]
+	if !ok {
+		return func(env *environment) any {
+			return env.globals.Get(name)
+		}
+	}
+	if b.hoisted {
+		return func(env *environment) any {
+			if b, ok := env.reach(b); ok {
+				return env.GetAt(b.depth, b.slot, name)
+			}
+			return env.globals.Get(name)
+		}
+	}
+	if b.depth == 0 {
+		slot := b.slot
+		return func(env *environment) any {
+			if slot >= len(env.values) {
+				panic(newRuntimeError(name, "Undefined variable '"+name.Lexeme+"'."))
+			}
+			return env.values[slot]
+		}
+	}
+	return func(env *environment) any {
+		return env.GetAt(b.depth, b.slot, name)
+	}
+}
+
+func (c *compiler) assign(e *ast.ExprAssign[any]) eval {
+	value := c.expr(e.Value)
+	b, ok := c.i.locals[e]
+	if !ok {
+		return func(env *environment) any {
+			value := value(env)
+			env.globals.Assign(e.Name, value)
+			return value
+		}
+	}
+	return func(env *environment) any {
+		value := value(env)
+		if b, ok := env.reach(b); ok {
+			env.AssignAt(b.depth, b.slot, e.Name, value)
+		} else {
+			env.globals.Assign(e.Name, value)
+		}
+		return value
+	}
+}
+
+func (c *compiler) unary(e *ast.ExprUnary[any]) eval {
+	right := c.expr(e.Right)
+	switch e.Token.Type {
+	case token.MINUS:
+		return func(env *environment) any {
+			right, ok := right(env).(float64)
+			if !ok {
+				panic(newRuntimeError(e.Token, "Operands must be numbers."))
+			}
+			return -right
+		}
+	case token.BANG:
+		return func(env *environment) any {
+			return !isTruthy(right(env))
+		}
+	}
+	return func(*environment) any { return nil }
+}
+
+// numbers returns the operands of an arithmetic or comparison operator.
+func numbers(operator token.Token, left, right any) (float64, float64) {
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		panic(newRuntimeError(operator, "Operands must be numbers."))
+	}
+	return l, r
+}
+
+func (c *compiler) binary(e *ast.ExprBinary[any]) eval {
+	left, right, operator := c.expr(e.Left), c.expr(e.Right), e.Token
+	switch operator.Type {
+	case token.MINUS:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l - r
+		}
+	case token.PLUS:
+		return func(env *environment) any {
+			left, right := left(env), right(env)
+			if s, ok := left.(string); ok {
+				s += fmt.Sprint(right)
+				c.i.alloc(operator, len(s))
+				return s
+			}
+			l, r := numbers(operator, left, right)
+			return l + r
+		}
+	case token.SLASH:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l / r
+		}
+	case token.STAR:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l * r
+		}
+	case token.GREATER:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l > r
+		}
+	case token.GREATER_EQUAL:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l >= r
+		}
+	case token.LESS:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l < r
+		}
+	case token.LESS_EQUAL:
+		return func(env *environment) any {
+			l, r := numbers(operator, left(env), right(env))
+			return l <= r
+		}
+	case token.BANG_EQUAL:
+		return func(env *environment) any {
+			return !isEqual(left(env), right(env))
+		}
+	case token.EQUAL_EQUAL:
+		return func(env *environment) any {
+			return isEqual(left(env), right(env))
+		}
+	}
+	return func(*environment) any { return nil }
+}
+
+func (c *compiler) call(e *ast.ExprCall[any]) eval {
+	callee, arguments := c.expr(e.Callee), c.exprs(e.Arguments)
+	paren, start := e.Param, e.Span().Start
+	return func(env *environment) any {
+		function, ok := callee(env).(ast.Callable[any])
+		if !ok {
+			panic(newRuntimeError(paren, "Can only call functions and classes."))
+		}
+		if function.Arity() != Variadic && len(arguments) != function.Arity() {
+			panic(newRuntimeError(paren, fmt.Sprint("Expected ",
+				function.Arity(), " arguments but got ",
+				len(arguments), ".")))
+		}
+		values := make([]any, len(arguments))
+		for n, argument := range arguments {
+			values[n] = argument(env)
+		}
+
+		c.i.step(paren)
+		c.i.enter(paren, function, start)
+		var value any
+		if native, ok := function.(*nativeFunction); ok {
+			value = c.i.callNative(native, paren, values...)
+		} else {
+			c.i.alloc(paren, callSize(function))
+			value = function.Call(c.i, values...)
+		}
+		c.i.frames = c.i.frames[:len(c.i.frames)-1]
+		return value
+	}
+}
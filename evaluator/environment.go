@@ -2,70 +2,131 @@ package evaluator
 
 import "github.com/cndoit18/lox/token"
 
+// Environment holds the variables of a scope. Globals are looked up by
+// name; locals live in slots computed by the resolver and are reached by
+// their distance from the current scope.
 type Environment interface {
 	Get(token.Token) any
 	Set(token.Token, any)
 	Assign(token.Token, any)
-	GetAt(distance int, key token.Token) any
-	AssignAt(int, token.Token, any)
+	GetAt(distance, slot int, key token.Token) any
+	AssignAt(distance, slot int, key token.Token, val any)
 }
 
-type environment struct {
-	enclosing Environment
+// globalEnvironment holds the globals of a script or module, enclosed by
+// the builtins they share.
+type globalEnvironment struct {
+	enclosing *globalEnvironment
 	data      map[string]any
-	ret       any
-	hasRet    bool
 }
 
-func NewEnvironment(enclosing Environment) Environment {
-	return &environment{
+func newGlobalEnvironment(enclosing *globalEnvironment) *globalEnvironment {
+	return &globalEnvironment{
 		enclosing: enclosing,
 		data:      map[string]any{},
-		ret:       nil,
 	}
 }
 
-func (e *environment) Get(key token.Token) any {
-	if v, ok := e.data[key.Lexeme]; ok {
-		return v
-	}
-
-	if e.enclosing == nil {
-		panic(newRuntimeError(key, "Undefined variable '"+key.Lexeme+"'."))
+func (g *globalEnvironment) Get(key token.Token) any {
+	for e := g; e != nil; e = e.enclosing {
+		if v, ok := e.data[key.Lexeme]; ok {
+			return v
+		}
 	}
+	panic(newRuntimeError(key, "Undefined variable '"+key.Lexeme+"'."))
+}
 
-	return e.enclosing.Get(key)
+func (g *globalEnvironment) Set(key token.Token, val any) {
+	g.data[key.Lexeme] = val
 }
 
-func (e *environment) GetAt(distance int, key token.Token) any {
-	if distance > 0 && e.enclosing != nil {
-		return e.enclosing.GetAt(distance-1, key)
+func (g *globalEnvironment) Assign(key token.Token, val any) {
+	for e := g; e != nil; e = e.enclosing {
+		if _, ok := e.data[key.Lexeme]; ok {
+			e.data[key.Lexeme] = val
+			return
+		}
 	}
+	panic(newRuntimeError(key, "Undefined variable '"+key.Lexeme+"'."))
+}
+
+// GetAt looks key up by name: the resolver leaves globals unresolved, so
+// they have no slots.
+func (g *globalEnvironment) GetAt(_, _ int, key token.Token) any {
+	return g.Get(key)
+}
 
-	return e.Get(key)
+func (g *globalEnvironment) AssignAt(_, _ int, key token.Token, val any) {
+	g.Assign(key, val)
 }
 
-func (e *environment) Set(key token.Token, val any) {
-	e.data[key.Lexeme] = val
+// environment holds the locals of a block or call. Variables are appended
+// to values as they are defined, which is the order the resolver gives
+// them slots in.
+type environment struct {
+	enclosing *environment
+	globals   *globalEnvironment
+	values    []any
 }
 
-func (e *environment) AssignAt(distance int, key token.Token, val any) {
-	if distance > 0 && e.enclosing != nil {
-		e.enclosing.AssignAt(distance-1, key, val)
+// NewEnvironment creates the scope of a block or call nested in enclosing.
+func NewEnvironment(enclosing Environment) Environment {
+	switch e := enclosing.(type) {
+	case *environment:
+		return &environment{enclosing: e, globals: e.globals}
+	case *globalEnvironment:
+		return &environment{globals: e}
 	}
+	return &environment{globals: newGlobalEnvironment(nil)}
+}
 
-	e.Assign(key, val)
+// Get looks up a variable the resolver left to the globals.
+func (e *environment) Get(key token.Token) any {
+	return e.globals.Get(key)
+}
+
+// Set defines the variable in the next slot.
+func (e *environment) Set(_ token.Token, val any) {
+	e.values = append(e.values, val)
 }
 
 func (e *environment) Assign(key token.Token, val any) {
-	if _, ok := e.data[key.Lexeme]; ok {
-		e.data[key.Lexeme] = val
-		return
+	e.globals.Assign(key, val)
+}
+
+func (e *environment) ancestor(distance int) *environment {
+	for ; distance > 0; distance-- {
+		e = e.enclosing
 	}
+	return e
+}
 
-	if e.enclosing == nil {
+func (e *environment) GetAt(distance, slot int, key token.Token) any {
+	values := e.ancestor(distance).values
+	if slot >= len(values) {
+		// a closure called from the initializer of the variable it reads.
 		panic(newRuntimeError(key, "Undefined variable '"+key.Lexeme+"'."))
 	}
+	return values[slot]
+}
+
+// reach returns the binding that b refers to from e, following the
+// hoisted functions whose declarations have not run yet out to the
+// bindings they shadow. It reports false when that is a global.
+func (e *environment) reach(b binding) (binding, bool) {
+	for b.hoisted && b.slot >= len(e.ancestor(b.depth).values) {
+		if b.outer == nil {
+			return b, false
+		}
+		b = *b.outer
+	}
+	return b, true
+}
 
-	e.enclosing.Assign(key, val)
+func (e *environment) AssignAt(distance, slot int, key token.Token, val any) {
+	values := e.ancestor(distance).values
+	if slot >= len(values) {
+		panic(newRuntimeError(key, "Undefined variable '"+key.Lexeme+"'."))
+	}
+	values[slot] = val
 }
@@ -1,8 +1,9 @@
 package evaluator
 
 import (
-	"fmt"
-
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/diagnostic"
+	"github.com/cndoit18/lox/limit"
 	"github.com/cndoit18/lox/token"
 )
 
@@ -13,11 +14,81 @@ func newRuntimeError(token token.Token, msg string) error {
 	}
 }
 
+// newInterruptError stops the script at token because of err, returned by
+// limit.Meter.Step.
+func newInterruptError(token token.Token, err error) error {
+	return &runtimeError{
+		token: token,
+		msg:   limit.Message(err),
+		cause: err,
+	}
+}
+
+// newThrowError wraps a value raised by a throw statement.
+func newThrowError(token token.Token, value any) error {
+	return &runtimeError{
+		token:  token,
+		msg:    builtin.Uncaught(value),
+		value:  value,
+		thrown: true,
+	}
+}
+
 type runtimeError struct {
 	token token.Token
 	msg   string
+	trace diagnostic.Trace
+	// notes are shown before the trace.
+	notes []string
+	// value is set when the error was raised by a throw statement.
+	value  any
+	thrown bool
+	// cause is set when the script was interrupted. Such errors can't be
+	// caught, and finally blocks don't run for them.
+	cause error
+}
+
+// Unwrap returns the reason the script was interrupted, if it was.
+func (r *runtimeError) Unwrap() error {
+	return r.cause
+}
+
+// interrupted reports whether r, recovered from a panic, stops the script
+// regardless of catch clauses.
+func interrupted(r any) bool {
+	err, ok := r.(*runtimeError)
+	return ok && err.cause != nil
+}
+
+// caught returns the value bound by a catch clause: either the thrown value
+// or an Error instance describing the runtime error.
+func (r *runtimeError) caught() any {
+	if r.thrown {
+		return r.value
+	}
+	return &loxInstance{
+		class: errorClass,
+		fields: map[string]any{
+			"message": r.msg,
+			"line":    float64(r.token.Line),
+		},
+	}
+}
+
+// Trace returns the stack of calls that were active when the error was raised.
+func (r *runtimeError) Trace() diagnostic.Trace {
+	return r.trace
 }
 
 func (r *runtimeError) Error() string {
-	return fmt.Sprintf("\n[line: %d]\t%s", r.token.Line, r.msg)
+	return r.Diagnostic().String()
+}
+
+func (r *runtimeError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     r.token.Span(),
+		Message:  r.msg,
+		Notes:    append(append([]string{}, r.notes...), r.trace.Notes()...),
+	}
 }
@@ -0,0 +1,1120 @@
+package evaluator
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cndoit18/lox/parser"
+	"github.com/cndoit18/lox/scanner"
+	"github.com/cndoit18/lox/token"
+)
+
+func TestClosure(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want map[string]any
+	}{
+		{
+			name: "counter",
+			src: `
+func makeCounter() {
+    var i = 0;
+    func count() {
+        i = i + 1;
+        return i;
+    }
+    return count;
+}
+var counter = makeCounter();
+counter();
+var x = counter();
+var y = makeCounter()();`,
+			want: map[string]any{"x": float64(2), "y": float64(1)},
+		},
+		{
+			name: "adder",
+			src: `
+func adder(n) {
+    func add(x) {
+        return x + n;
+    }
+    return add;
+}
+var add5 = adder(5);
+var add7 = adder(7);
+var x = add5(1);
+var y = add7(1);`,
+			want: map[string]any{"x": float64(6), "y": float64(8)},
+		},
+		{
+			name: "static scope",
+			src: `
+var a = "global";
+var first;
+var second;
+var third;
+{
+    func showA() {
+        return a;
+    }
+
+    first = showA();
+    var a = "block";
+    second = showA();
+    third = a;
+}`,
+			want: map[string]any{"first": "global", "second": "global", "third": "block"},
+		},
+		{
+			name: "assign captured",
+			src: `
+var a = "global";
+{
+    func setA() {
+        a = "assigned";
+    }
+    var a = "block";
+    setA();
+}`,
+			want: map[string]any{"a": "assigned"},
+		},
+		{
+			name: "redeclared local",
+			src: `
+var x;
+var y;
+{
+    var a = 1;
+    var b = a + 1;
+    var a = b + 1;
+    x = a;
+    a = 5;
+    y = a + b;
+}`,
+			want: map[string]any{"x": float64(3), "y": float64(7)},
+		},
+		{
+			name: "recursive lambda",
+			src: `
+var x;
+{
+    var fact = func (n) {
+        if (n <= 1) return 1;
+        return n * fact(n - 1);
+    };
+    x = fact(5);
+}`,
+			want: map[string]any{"x": float64(120)},
+		},
+		{
+			name: "mutually recursive locals",
+			src: `
+var x;
+var y;
+{
+    func isEven(n) {
+        if (n == 0) return true;
+        return isOdd(n - 1);
+    }
+    func isOdd(n) {
+        if (n == 0) return false;
+        return isEven(n - 1);
+    }
+    x = isEven(4);
+    y = isOdd(4);
+}`,
+			want: map[string]any{"x": true, "y": false},
+		},
+		{
+			name: "closures are compared by identity",
+			src: `
+func mk() {
+    func f() {}
+    return f;
+}
+var f = mk();
+var same = f == f;
+var other = mk() == mk();`,
+			want: map[string]any{"same": true, "other": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := run(t, New(), tt.src)
+			for name, want := range tt.want {
+				got := environment.Get(token.Token{Lexeme: name})
+				if got != want {
+					t.Errorf("Get(%s) got = %v, want = %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "fields",
+			src: `
+class Point {}
+var p = Point();
+p.x = 1;
+p.y = p.x + 1;
+var x = p.x;
+var y = p.y;
+var s = str(p);`,
+			want: map[string]any{"x": float64(1), "y": float64(2), "s": "Point instance"},
+		},
+		{
+			name: "bound method",
+			src: `
+class Counter {
+    init(n) {
+        this.n = n;
+    }
+    get() {
+        return this.n;
+    }
+}
+var c = Counter(3);
+var get = c.get;
+var a = get();
+var other = Counter(4);
+other.get = c.get;
+var b = other.get();`,
+			want: map[string]any{"a": float64(3), "b": float64(3)},
+		},
+		{
+			name: "init returns this",
+			src: `
+class Box {
+    init() {
+        this.v = 1;
+    }
+}
+var box = Box();
+box.v = 2;
+var same = box.init() == box;
+var v = box.v;`,
+			want: map[string]any{"same": true, "v": float64(1)},
+		},
+		{
+			name: "return in init",
+			src: `
+class Box {
+    init(early) {
+        this.v = 1;
+        if (early) return;
+        this.v = 2;
+    }
+}
+var a = Box(true).v;
+var b = Box(false).v;
+var c = Box(true).init(false).v;`,
+			want: map[string]any{"a": float64(1), "b": float64(2), "c": float64(2)},
+		},
+		{
+			name: "bound methods are compared by method and instance",
+			src: `
+class A {
+    m() {}
+    n() {}
+}
+var p = A();
+var q = A();
+var same = p.m == p.m;
+var method = p.m == p.n;
+var instance = p.m == q.m;`,
+			want: map[string]any{"same": true, "method": false, "instance": false},
+		},
+		{
+			name:    "undefined property",
+			src:     "class Box {}\nBox().v;",
+			wantErr: "2:7: error: Undefined property 'v'.",
+		},
+		{
+			name:    "this outside class",
+			src:     "func f() {\n    return this;\n}",
+			wantErr: "2:12: error: Can't use 'this' outside of a class.",
+		},
+		{
+			name:    "return value from init",
+			src:     "class Box {\n    init() {\n        return 1;\n    }\n}",
+			wantErr: "3:9: error: Can't return a value from an initializer.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestInheritance(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "inherited method",
+			src: `
+class A {
+    name() {
+        return "A";
+    }
+}
+class B < A {}
+var name = B().name();`,
+			want: map[string]any{"name": "A"},
+		},
+		{
+			name: "multi-level super",
+			src: `
+class A {
+    name() {
+        return "A";
+    }
+    greet() {
+        return "hi " + this.name();
+    }
+}
+class B < A {
+    name() {
+        return "B" + super.name();
+    }
+}
+class C < B {}
+class D < C {
+    name() {
+        return "D" + super.name();
+    }
+}
+var name = D().name();
+var greeting = D().greet();`,
+			want: map[string]any{"name": "DBA", "greeting": "hi DBA"},
+		},
+		{
+			name: "super init",
+			src: `
+class A {
+    init(n) {
+        this.n = n;
+    }
+}
+class B < A {
+    init(n) {
+        super.init(n * 2);
+    }
+}
+var n = B(2).n;`,
+			want: map[string]any{"n": float64(4)},
+		},
+		{
+			name:    "inherit from itself",
+			src:     "class A < A {}",
+			wantErr: "1:11: error: A class can't inherit from itself.",
+		},
+		{
+			name:    "superclass not a class",
+			src:     "var A = 1;\nclass B < A {}",
+			wantErr: "2:11: error: Superclass must be a class.",
+		},
+		{
+			name:    "super without superclass",
+			src:     "class A {\n    f() {\n        return super.f();\n    }\n}",
+			wantErr: "3:16: error: Can't use 'super' in a class with no superclass.",
+		},
+		{
+			name:    "super outside class",
+			src:     "super.f();",
+			wantErr: "1:1: error: Can't use 'super' outside of a class.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestNative(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		want     map[string]any
+		wantLine int
+	}{
+		{
+			name: "standard",
+			src: `
+var a = typeof(clock());
+var b = len("héllo");
+var c = str(1.5) + "!";
+var d = num(" 42 ") + 1;
+var e = typeof(typeof);`,
+			want: map[string]any{"a": "number", "b": float64(5), "c": "1.5!", "d": float64(43), "e": "function"},
+		},
+		{
+			name: "host",
+			src:  `var a = sum(1, 2, 3); var b = sum(); var c = answer;`,
+			want: map[string]any{"a": float64(6), "b": float64(0), "c": float64(42)},
+		},
+		{
+			name:     "host error",
+			src:      "var a = 1;\nvar b = sum(1, \"2\");",
+			wantLine: 2,
+		},
+		{
+			name:     "standard error",
+			src:      "\n\nnum(\"abc\");",
+			wantLine: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New()
+			r.Define("answer", float64(42))
+			r.DefineNative("sum", Variadic, func(args ...any) (any, error) {
+				total := float64(0)
+				for _, arg := range args {
+					n, ok := arg.(float64)
+					if !ok {
+						return nil, errors.New("sum() expects numbers.")
+					}
+					total += n
+				}
+				return total, nil
+			})
+
+			defer func() {
+				if tt.wantLine == 0 {
+					return
+				}
+				err, ok := recover().(*runtimeError)
+				if !ok {
+					t.Errorf("expected a runtime error")
+					return
+				}
+				if err.token.Line != tt.wantLine {
+					t.Errorf("runtime error line got = %d, want = %d", err.token.Line, tt.wantLine)
+				}
+			}()
+			environment := run(t, r, tt.src)
+			for name, want := range tt.want {
+				got := environment.Get(token.Token{Lexeme: name})
+				if got != want {
+					t.Errorf("Get(%s) got = %v, want = %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestException(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "catch thrown value",
+			src: `
+var a;
+try {
+    throw 42;
+} catch (e) {
+    a = e;
+}`,
+			want: map[string]any{"a": float64(42)},
+		},
+		{
+			name: "catch runtime error",
+			src: `
+var message;
+var line;
+func fail() {
+    return nil + 1;
+}
+try {
+    fail();
+} catch (e) {
+    message = e.message;
+    line = e.line;
+}`,
+			want: map[string]any{"message": "Operands must be numbers.", "line": float64(5)},
+		},
+		{
+			name: "finally",
+			src: `
+var steps = "";
+func f() {
+    try {
+        steps = steps + "try ";
+        return 1;
+    } finally {
+        steps = steps + "finally";
+    }
+}
+var result = f();`,
+			want: map[string]any{"steps": "try finally", "result": float64(1)},
+		},
+		{
+			name: "rethrow",
+			src: `
+var a;
+try {
+    try {
+        throw "inner";
+    } catch (e) {
+        throw e + " again";
+    }
+} catch (e) {
+    a = e;
+}`,
+			want: map[string]any{"a": "inner again"},
+		},
+		{
+			name:    "uncaught",
+			src:     "var a = 1;\nthrow a;",
+			wantErr: "2:1: error: Uncaught exception: 1",
+		},
+		{
+			name: "uncaught error instance",
+			src: `
+func f() {
+    try {
+        nil();
+    } catch (e) {
+        throw e;
+    }
+}
+f();`,
+			wantErr: "6:9: error: Uncaught Error: Can only call functions and classes.\n\tin f() at 6:9\n\tin script at 9:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestLoopControl(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "for continue runs increment",
+			src: `
+var sum = 0;
+for (var i = 0; i < 10; i = i + 1) {
+    if (i == 2 or i == 5) {
+        continue;
+    }
+    sum = sum + i;
+}`,
+			want: map[string]any{"sum": float64(38)},
+		},
+		{
+			name: "while break",
+			src: `
+var i = 0;
+while (true) {
+    i = i + 1;
+    if (i == 4) break;
+}`,
+			want: map[string]any{"i": float64(4)},
+		},
+		{
+			name: "nested",
+			src: `
+var pairs = "";
+for (var i = 0; i < 3; i = i + 1) {
+    for (var j = 0; j < 3; j = j + 1) {
+        if (j > i) break;
+        if (j == 1) continue;
+        pairs = pairs + i + j + " ";
+    }
+}`,
+			want: map[string]any{"pairs": "00 10 20 22 "},
+		},
+		{
+			name: "break through finally",
+			src: `
+var steps = "";
+while (true) {
+    try {
+        break;
+    } finally {
+        steps = steps + "finally";
+    }
+}`,
+			want: map[string]any{"steps": "finally"},
+		},
+		{
+			name: "return in finally discards error",
+			src: `
+func f() {
+    try {
+        nil + 1;
+    } finally {
+        return "finally";
+    }
+}
+var result = f();`,
+			want: map[string]any{"result": "finally"},
+		},
+		{
+			name: "return in finally unwinds calls",
+			src: `
+func g() {
+    nil + 1;
+}
+func f() {
+    try {
+        g();
+    } finally {
+        return "finally";
+    }
+}
+f();
+f();
+-"a";`,
+			wantErr: "14:1: error: Operands must be numbers.",
+		},
+		{
+			name: "return from loop",
+			src: `
+func first(items) {
+    for (var item in items) {
+        if (item > 1) return item;
+    }
+}
+var result = first([1, 2, 3]);
+var missing = first([]);`,
+			want: map[string]any{"result": float64(2), "missing": nil},
+		},
+		{
+			name:    "break outside loop",
+			src:     "if (true) break;",
+			wantErr: "1:11: error: Can't use 'break' outside of a loop.",
+		},
+		{
+			name:    "continue in function inside loop",
+			src:     "while (true) {\n  func f() { continue; }\n}",
+			wantErr: "2:14: error: Can't use 'continue' outside of a loop.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "literal and index",
+			src: `
+var xs = [1, "two", [3]];
+var a = xs[1];
+var b = xs[2][0];
+xs[0] = xs[0] + 10;
+var c = xs[0];
+var d = str(xs);
+var e = len(xs);`,
+			want: map[string]any{"a": "two", "b": float64(3), "c": float64(11), "d": `[11, "two", [3]]`, "e": float64(3)},
+		},
+		{
+			name: "natives",
+			src: `
+var xs = [];
+push(xs, 1);
+push(xs, 3);
+insert(xs, 1, 2);
+insert(xs, 0, 0);
+var popped = pop(xs);
+var sliced = str(slice(xs, 1, 3));
+var all = str(xs);
+var has = contains(xs, 2);
+var missing = contains(xs, 3);
+var kind = typeof(xs);`,
+			want: map[string]any{"popped": float64(3), "sliced": "[1, 2]", "all": "[0, 1, 2]", "has": true, "missing": false, "kind": "list"},
+		},
+		{
+			name: "identity",
+			src: `
+var xs = [1];
+var ys = xs;
+var same = xs == ys;
+var other = xs == [1];
+push(ys, 2);
+var n = len(xs);`,
+			want: map[string]any{"same": true, "other": false, "n": float64(2)},
+		},
+		{
+			name: "contains itself",
+			src: `
+var xs = [1];
+push(xs, xs);
+var a = str(xs);
+var b = "" + [xs, xs];`,
+			want: map[string]any{"a": "[1, [...]]", "b": "[[1, [...]], [1, [...]]]"},
+		},
+		{
+			name:    "negative index",
+			src:     "var xs = [1];\nxs[-1];",
+			wantErr: "2:6: error: List index -1 out of range for length 1.",
+		},
+		{
+			name:    "out of range",
+			src:     "var xs = [1];\nxs[1] = 2;",
+			wantErr: "2:5: error: List index 1 out of range for length 1.",
+		},
+		{
+			name:    "fractional index",
+			src:     "[1][0.5];",
+			wantErr: "1:8: error: List index must be an integer.",
+		},
+		{
+			name:    "pop empty",
+			src:     "pop([]);",
+			wantErr: "1:7: error: Can't pop from an empty list.\n\tin pop() at 1:7\n\tin script at 1:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "literal and index",
+			src: `
+var m = {"a": 1, 2: "two", "nested": {"b": [3]},};
+var a = m["a"];
+var b = m[2];
+var c = m["nested"]["b"][0];
+m["a"] = m["a"] + 10;
+m["z"] = nil;
+var d = str(m);
+var e = len(m);
+var f = str({});`,
+			want: map[string]any{"a": float64(1), "b": "two", "c": float64(3), "d": `{"a": 11, 2: "two", "nested": {"b": [3]}, "z": <nil>}`, "e": float64(4), "f": "{}"},
+		},
+		{
+			name: "natives",
+			src: `
+var m = {"x": 1, "y": 2, "z": 3};
+var hasX = has(m, "x");
+var deleted = delete(m, "y");
+var again = delete(m, "y");
+var hasY = has(m, "y");
+var k = str(keys(m));
+var v = str(values(m));
+var kind = typeof(m);`,
+			want: map[string]any{"hasX": true, "deleted": true, "again": false, "hasY": false, "k": `["x", "z"]`, "v": "[1, 3]", "kind": "map"},
+		},
+		{
+			name: "identity",
+			src: `
+var m = {"a": 1};
+var n = m;
+var same = m == n;
+var other = m == {"a": 1};`,
+			want: map[string]any{"same": true, "other": false},
+		},
+		{
+			name: "contains itself",
+			src: `
+var m = {"n": 1};
+m["self"] = m;
+m["list"] = [m];
+var a = str(m);
+var b = "m = " + m;`,
+			want: map[string]any{
+				"a": `{"n": 1, "self": {...}, "list": [{...}]}`,
+				"b": `m = {"n": 1, "self": {...}, "list": [{...}]}`,
+			},
+		},
+		{
+			name:    "missing key",
+			src:     "var m = {\"a\": 1};\nm[\"b\"];",
+			wantErr: `2:6: error: Undefined key "b".`,
+		},
+		{
+			name:    "invalid key",
+			src:     "var m = {};\nm[nil] = 1;",
+			wantErr: "2:6: error: Map keys must be strings or numbers.",
+		},
+		{
+			name:    "invalid literal key",
+			src:     "var m = {[]: 1};",
+			wantErr: "1:9: error: Map keys must be strings or numbers.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestForIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "list",
+			src: `
+var xs = [1, 2, 3];
+var sum = 0;
+for (var x in xs) {
+  if (x == 1) push(xs, 4);
+  sum = sum + x;
+}`,
+			want: map[string]any{"sum": float64(10)},
+		},
+		{
+			name: "map keys and string",
+			src: `
+var joined = "";
+for (var k in {"a": 1, "b": 2}) joined = joined + k;
+for (var c in "xyz") joined = joined + c;`,
+			want: map[string]any{"joined": "abxyz"},
+		},
+		{
+			name: "range",
+			src: `
+var up = [];
+for (var i in range(3)) push(up, i);
+var down = [];
+for (var i in range(5, 0, -2)) push(down, i);
+var a = str(up);
+var b = str(down);
+var c = str(range(1, 4));`,
+			want: map[string]any{"a": "[0, 1, 2]", "b": "[5, 3, 1]", "c": "range(1, 4, 1)"},
+		},
+		{
+			name: "per iteration variable",
+			src: `
+var fns = [];
+for (var i in range(3)) {
+  func f() { return i; }
+  push(fns, f);
+}
+var first = fns[0]();
+var last = fns[2]();`,
+			want: map[string]any{"first": float64(0), "last": float64(2)},
+		},
+		{
+			name: "break and continue",
+			src: `
+var seen = "";
+for (var c in "abcdef") {
+  if (c == "b") continue;
+  if (c == "e") break;
+  seen = seen + c;
+}`,
+			want: map[string]any{"seen": "acd"},
+		},
+		{
+			name: "protocol",
+			src: `
+class Countdown {
+  init(n) { this.n = n; }
+  iterator() { return Cursor(this.n); }
+}
+class Cursor {
+  init(n) { this.n = n; }
+  hasNext() { return this.n > 0; }
+  next() {
+    this.n = this.n - 1;
+    return this.n + 1;
+  }
+}
+var out = "";
+for (var n in Countdown(3)) out = out + n;`,
+			want: map[string]any{"out": "321"},
+		},
+		{
+			name:    "not iterable",
+			src:     "for (var x in 1) print x;",
+			wantErr: "1:1: error: Can't iterate over a value of type number.",
+		},
+		{
+			name:    "zero step",
+			src:     "range(0, 1, 0);",
+			wantErr: "1:14: error: range() step can't be zero.\n\tin range() at 1:14\n\tin script at 1:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestLambda(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name: "block and arrow",
+			src: `
+var add = func (a, b) { return a + b; };
+var double = func (x) => x * 2;
+var a = add(1, 2);
+var b = double(a);
+var c = (func () => "now")();
+var d = str(double);`,
+			want: map[string]any{"a": float64(3), "b": float64(6), "c": "now", "d": "<fn lambda>"},
+		},
+		{
+			name: "closure",
+			src: `
+func counter() {
+  var n = 0;
+  return func () => n = n + 1;
+}
+var next = counter();
+next();
+var n = next();`,
+			want: map[string]any{"n": float64(2)},
+		},
+		{
+			name: "callback",
+			src: `
+func each(xs, f) {
+  for (var x in xs) f(x);
+}
+var sum = 0;
+each([1, 2, 3], func (x) { sum = sum + x; });`,
+			want: map[string]any{"sum": float64(6)},
+		},
+		{
+			name: "this in method",
+			src: `
+class Box {
+  init(v) { this.v = v; }
+  getter() { return func () => this.v; }
+}
+var v = Box(7).getter()();`,
+			want: map[string]any{"v": float64(7)},
+		},
+		{
+			name:    "trace",
+			src:     "var f = func () => nil + 1;\nf();",
+			wantErr: "1:24: error: Operands must be numbers.\n\tin lambda() at 1:24\n\tin script at 2:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectGlobals(t, tt.src, tt.want, tt.wantErr)
+		})
+	}
+}
+
+// expectGlobals runs src and checks either the values of global variables
+// or the error it fails with.
+func expectGlobals(t *testing.T, src string, want map[string]any, wantErr string) {
+	t.Helper()
+	scan, err := scanner.NewScanner(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("NewScanner() error = %v", err)
+	}
+	stmts, err := parser.NewParser[any](scan.ScanTokens()...).Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	r := New()
+	_, err = r.Run(stmts)
+	if err != nil {
+		if err.Error() != wantErr {
+			t.Errorf("Run() error = %q, wantErr = %q", err, wantErr)
+		}
+		return
+	}
+	if wantErr != "" {
+		t.Fatalf("Run() error = nil, wantErr = %q", wantErr)
+	}
+	for name, want := range want {
+		got := r.Interpreter().globals.Get(token.Token{Lexeme: name})
+		if got != want {
+			t.Errorf("Get(%s) got = %v, want = %v", name, got, want)
+		}
+	}
+}
+
+func run(t *testing.T, resolver *Resolver, src string) Environment {
+	t.Helper()
+	scan, err := scanner.NewScanner(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("NewScanner() error = %v", err)
+	}
+	tokens := scan.ScanTokens()
+	if err := scan.Err(); err != nil {
+		t.Fatalf("ScanTokens() error = %v", err)
+	}
+	stmts, err := parser.NewParser[any](tokens...).Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	interpreter := resolver.Interpreter()
+	for _, stmt := range stmts {
+		stmt.Accept(resolver)
+	}
+	for _, stmt := range stmts {
+		stmt.Accept(interpreter)
+	}
+	return interpreter.environment
+}
+
+func TestStackTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "top level",
+			src:  `var a = -"a";`,
+		},
+		{
+			name: "recursive",
+			src: `func inner(n) {
+    if (n == 0) {
+        return "x" - n;
+    }
+    return inner(n - 1);
+}
+func outer() {
+    return inner(1);
+}
+outer();`,
+			want: []string{
+				"in inner() at 3:20",
+				"in inner() at 5:12",
+				"in outer() at 8:12",
+				"in script at 10:1",
+			},
+		},
+		{
+			name: "native",
+			src: `func parse(s) {
+    return num(s);
+}
+parse("a");`,
+			want: []string{
+				"in num() at 2:17",
+				"in parse() at 2:12",
+				"in script at 4:1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan, err := scanner.NewScanner(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("NewScanner() error = %v", err)
+			}
+			stmts, err := parser.NewParser[any](scan.ScanTokens()...).Parse()
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			_, err = New().Run(stmts)
+			runtime, ok := err.(*runtimeError)
+			if !ok {
+				t.Fatalf("Run() error = %v, want a runtime error", err)
+			}
+			got := []string{}
+			for _, frame := range runtime.Trace() {
+				got = append(got, frame.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Trace() got = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func BenchmarkLoop(b *testing.B) {
+	benchmark(b, `
+var total = 0;
+for (var i = 1; i <= 100; i = i + 1) {
+    for (var j = 1; j <= 100; j = j + 1) {
+        total = total + i * j;
+    }
+}`)
+}
+
+func BenchmarkCall(b *testing.B) {
+	benchmark(b, `
+func fib(n) {
+    if (n < 2) return n;
+    return fib(n - 1) + fib(n - 2);
+}
+fib(15);`)
+}
+
+// benchmark runs src with the tree walker and with the closure compiler.
+func benchmark(b *testing.B, src string) {
+	scan, err := scanner.NewScanner(strings.NewReader(src))
+	if err != nil {
+		b.Fatalf("NewScanner() error = %v", err)
+	}
+	stmts, err := parser.NewParser[any](scan.ScanTokens()...).Parse()
+	if err != nil {
+		b.Fatalf("Parse() error = %v", err)
+	}
+	for _, mode := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "tree"},
+		{name: "closure", opts: []Option{WithClosureCompiler()}},
+	} {
+		b.Run(mode.name, func(b *testing.B) {
+			r := New(mode.opts...)
+			for n := 0; n < b.N; n++ {
+				if _, err := r.Run(stmts); err != nil {
+					b.Fatalf("Run() error = %v", err)
+				}
+			}
+		})
+	}
+}
@@ -2,9 +2,10 @@ package evaluator
 
 import (
 	"fmt"
-	"reflect"
 
 	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/limit"
 	"github.com/cndoit18/lox/token"
 )
 
@@ -19,7 +20,7 @@ func (i *evaluator) VisitorExprCall(s *ast.ExprCall[any]) any {
 		panic(newRuntimeError(s.Param, "Can only call functions and classes."))
 	}
 
-	if len(s.Arguments) != function.Arity() {
+	if function.Arity() != Variadic && len(s.Arguments) != function.Arity() {
 		panic(newRuntimeError(s.Param, fmt.Sprint("Expected ",
 			function.Arity(), " arguments but got ",
 			len(s.Arguments), ".")))
@@ -30,7 +31,31 @@ func (i *evaluator) VisitorExprCall(s *ast.ExprCall[any]) any {
 		arguments = append(arguments, i.evaluate(arg))
 	}
 
-	return function.Call(i, arguments...)
+	i.step(s.Param)
+	i.enter(s.Param, function, s.Span().Start)
+	var value any
+	if native, ok := function.(*nativeFunction); ok {
+		value = i.callNative(native, s.Param, arguments...)
+	} else {
+		i.alloc(s.Param, callSize(function))
+		value = function.Call(i, arguments...)
+	}
+	i.frames = i.frames[:len(i.frames)-1]
+	return value
+}
+
+func functionName(function ast.Callable[any]) string {
+	switch f := function.(type) {
+	case *warpperFunction:
+		return f.name
+	case *compiledFunction:
+		return f.name
+	case *loxClass:
+		return f.name
+	case *nativeFunction:
+		return f.name
+	}
+	return fmt.Sprint(function)
 }
 
 func (i *evaluator) VisitorExprBinary(e *ast.ExprBinary[any]) any {
@@ -45,7 +70,9 @@ func (i *evaluator) VisitorExprBinary(e *ast.ExprBinary[any]) any {
 	case token.PLUS:
 		ls, lok := left.(string)
 		if lok {
-			return ls + fmt.Sprint(right)
+			s := ls + fmt.Sprint(right)
+			i.alloc(e.Token, len(s))
+			return s
 		}
 		checkNumberOperands(e.Token, left, right)
 		return left.(float64) + right.(float64)
@@ -68,9 +95,9 @@ func (i *evaluator) VisitorExprBinary(e *ast.ExprBinary[any]) any {
 		checkNumberOperands(e.Token, left, right)
 		return left.(float64) <= right.(float64)
 	case token.BANG_EQUAL:
-		return !reflect.DeepEqual(left, right)
+		return !isEqual(left, right)
 	case token.EQUAL_EQUAL:
-		return reflect.DeepEqual(left, right)
+		return isEqual(left, right)
 	}
 	return nil
 }
@@ -99,7 +126,7 @@ func (i *evaluator) VisitorExprUnary(e *ast.ExprUnary[any]) any {
 		checkNumberOperands(e.Token, right)
 		return -right.(float64)
 	case token.BANG:
-		return isTruthy(right)
+		return !isTruthy(right)
 	}
 	return nil
 }
@@ -109,7 +136,11 @@ func (i *evaluator) VisitorExprAssign(e *ast.ExprAssign[any]) any {
 		return nil
 	}
 	value := i.evaluate(e.Value)
-	i.environment.AssignAt(i.locals[e], e.Name, value)
+	if b, ok := i.reach(e); ok {
+		i.environment.AssignAt(b.depth, b.slot, e.Name, value)
+	} else {
+		i.environment.Assign(e.Name, value)
+	}
 	return value
 }
 
@@ -138,6 +169,170 @@ func (i *evaluator) VisitorExprLogical(s *ast.ExprLogical[any]) any {
 	return i.evaluate(s.Right)
 }
 
+func (i *evaluator) VisitorExprGet(e *ast.ExprGet[any]) any {
+	if e == nil {
+		return nil
+	}
+	switch object := i.evaluate(e.Object).(type) {
+	case *loxInstance:
+		return object.Get(e.Name)
+	case *loxModule:
+		return object.Get(e.Name)
+	}
+	panic(newRuntimeError(e.Name, "Only instances have properties."))
+}
+
+func (i *evaluator) VisitorExprSet(e *ast.ExprSet[any]) any {
+	if e == nil {
+		return nil
+	}
+	instance, ok := i.evaluate(e.Object).(*loxInstance)
+	if !ok {
+		panic(newRuntimeError(e.Name, "Only instances have fields."))
+	}
+	value := i.evaluate(e.Value)
+	if _, ok := instance.fields[e.Name.Lexeme]; !ok {
+		i.alloc(e.Name, 2*limit.SlotSize)
+	}
+	instance.Set(e.Name, value)
+	return value
+}
+
+func (i *evaluator) VisitorExprThis(e *ast.ExprThis[any]) any {
+	if e == nil {
+		return nil
+	}
+	return i.lookUpVariable(e.Keyword, e)
+}
+
+func (i *evaluator) VisitorExprSuper(e *ast.ExprSuper[any]) any {
+	if e == nil {
+		return nil
+	}
+	distance := i.locals[e].depth
+	superclass := i.environment.GetAt(distance, 0, e.Keyword).(*loxClass)
+	// "this" is always one level nearer than "super", and both are alone
+	// in their scopes.
+	object := i.environment.GetAt(distance-1, 0, thisToken).(*loxInstance)
+	method := superclass.findMethod(e.Method.Lexeme)
+	if method == nil {
+		panic(newRuntimeError(e.Method, "Undefined property '"+e.Method.Lexeme+"'."))
+	}
+	return method.bind(object)
+}
+
+func (i *evaluator) VisitorExprList(e *ast.ExprList[any]) any {
+	if e == nil {
+		return nil
+	}
+	elements := make([]any, 0, len(e.Elements))
+	for _, element := range e.Elements {
+		elements = append(elements, i.evaluate(element))
+	}
+	i.alloc(e.Lbracket, limit.ObjectSize+limit.SlotSize*len(elements))
+	return &builtin.List{Elements: elements}
+}
+
+func (i *evaluator) VisitorExprIndex(e *ast.ExprIndex[any]) any {
+	if e == nil {
+		return nil
+	}
+	object, index := i.evaluate(e.Object), i.evaluate(e.Index)
+	return getIndex(e.Rbracket, object, index)
+}
+
+// getIndex returns object[index] for the index expression closed by
+// bracket.
+func getIndex(bracket token.Token, object, index any) any {
+	var value any
+	var err error
+	switch object := object.(type) {
+	case *builtin.List:
+		value, err = object.Get(index)
+	case *builtin.Map:
+		value, err = object.Get(index)
+	default:
+		panic(newRuntimeError(bracket, "Only lists and maps can be indexed."))
+	}
+	if err != nil {
+		panic(newRuntimeError(bracket, err.Error()))
+	}
+	return value
+}
+
+func (i *evaluator) VisitorExprIndexSet(e *ast.ExprIndexSet[any]) any {
+	if e == nil {
+		return nil
+	}
+	object, index := i.evaluate(e.Object), i.evaluate(e.Index)
+	container, ok := object.(interface {
+		Set(any, any) error
+	})
+	if !ok {
+		panic(newRuntimeError(e.Rbracket, "Only lists and maps can be indexed."))
+	}
+	value := i.evaluate(e.Value)
+	before := builtin.Footprint(object)
+	if err := container.Set(index, value); err != nil {
+		panic(newRuntimeError(e.Rbracket, err.Error()))
+	}
+	if grown := builtin.Footprint(object) - before; grown > 0 {
+		i.alloc(e.Rbracket, grown)
+	}
+	return value
+}
+
+func (i *evaluator) VisitorExprFunction(e *ast.ExprFunction[any]) any {
+	if e == nil {
+		return nil
+	}
+	i.alloc(e.Keyword, limit.ObjectSize)
+	return &warpperFunction{
+		name:    lambdaName,
+		params:  e.Params,
+		body:    e.Body,
+		closure: i.environment,
+	}
+}
+
+func (i *evaluator) VisitorExprMap(e *ast.ExprMap[any]) any {
+	if e == nil {
+		return nil
+	}
+	m := builtin.NewMap()
+	for n, key := range e.Keys {
+		k := i.evaluate(key)
+		if !builtin.IsKey(k) {
+			panic(newRuntimeError(e.Lbrace, "Map keys must be strings or numbers."))
+		}
+		m.Put(k, i.evaluate(e.Values[n]))
+	}
+	i.alloc(e.Lbrace, builtin.Footprint(m))
+	return m
+}
+
+// isEqual compares objects by identity, not by contents.
+func isEqual(a, b any) bool {
+	// a method is bound anew every time it is read.
+	if method, receiver := boundTo(a); method != nil {
+		other, otherReceiver := boundTo(b)
+		return method == other && receiver == otherReceiver
+	}
+	return a == b
+}
+
+// boundTo returns the method and instance that value was bound from, or
+// nil if it is not a bound method.
+func boundTo(value any) (method, *loxInstance) {
+	switch f := value.(type) {
+	case *warpperFunction:
+		return f.unbound, f.receiver
+	case *compiledFunction:
+		return f.unbound, f.receiver
+	}
+	return nil, nil
+}
+
 func isTruthy(obj any) bool {
 	if obj == nil {
 		return false
@@ -164,5 +359,18 @@ func (i *evaluator) evaluate(e ast.Expr[any]) any {
 }
 
 func (i *evaluator) lookUpVariable(name token.Token, expr ast.Expr[any]) any {
-	return i.environment.GetAt(i.locals[expr], name)
+	if b, ok := i.reach(expr); ok {
+		return i.environment.GetAt(b.depth, b.slot, name)
+	}
+	return i.environment.Get(name)
+}
+
+// reach returns the binding of the local that expr refers to, or false
+// when it refers to a global.
+func (i *evaluator) reach(expr ast.Expr[any]) (binding, bool) {
+	b, ok := i.locals[expr]
+	if ok && b.hoisted {
+		return i.environment.(*environment).reach(b)
+	}
+	return b, ok
 }
@@ -0,0 +1,75 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/token"
+)
+
+// iterator yields the next element of a sequence, reporting false once the
+// sequence is exhausted.
+type iterator func() (any, bool)
+
+// iterate returns an iterator over value. Lists, map keys, string
+// characters and ranges are built in; instances take part by defining
+// hasNext() and next(), or an iterator() method returning such an object.
+func (i *evaluator) iterate(keyword token.Token, value any) iterator {
+	if next, ok := builtin.Iterate(value); ok {
+		return next
+	}
+	if v, ok := value.(*loxInstance); ok {
+		if hasNext, next, ok := protocol(v); ok {
+			return i.iterateInstance(keyword, hasNext, next)
+		}
+		if method, ok := v.method("iterator"); ok {
+			it, ok := i.invoke(keyword, method).(*loxInstance)
+			if !ok {
+				panic(newRuntimeError(keyword, "iterator() must return an object with hasNext() and next() methods."))
+			}
+			hasNext, next, ok := protocol(it)
+			if !ok {
+				panic(newRuntimeError(keyword, "iterator() must return an object with hasNext() and next() methods."))
+			}
+			return i.iterateInstance(keyword, hasNext, next)
+		}
+	}
+	panic(newRuntimeError(keyword, fmt.Sprintf("Can't iterate over %s.", engine.Describe(value))))
+}
+
+func (i *evaluator) iterateInstance(keyword token.Token, hasNext, next ast.Callable[any]) iterator {
+	return func() (any, bool) {
+		if !isTruthy(i.invoke(keyword, hasNext)) {
+			return nil, false
+		}
+		return i.invoke(keyword, next), true
+	}
+}
+
+// protocol looks up the hasNext and next methods of an iterator object.
+func protocol(instance *loxInstance) (hasNext, next ast.Callable[any], ok bool) {
+	hasNext, ok = instance.method("hasNext")
+	if !ok {
+		return nil, nil, false
+	}
+	next, ok = instance.method("next")
+	return hasNext, next, ok
+}
+
+// invoke calls a function that takes no arguments on behalf of the for
+// statement at keyword, so that errors inside it are traced back there.
+func (i *evaluator) invoke(keyword token.Token, function ast.Callable[any]) any {
+	if function.Arity() != 0 && function.Arity() != Variadic {
+		panic(newRuntimeError(keyword, fmt.Sprintf("%s() must take no arguments.", functionName(function))))
+	}
+	i.enter(keyword, function, keyword.Pos())
+	var value any
+	if native, ok := function.(*nativeFunction); ok {
+		value = i.callNative(native, keyword)
+	} else {
+		value = function.Call(i)
+	}
+	i.frames = i.frames[:len(i.frames)-1]
+	return value
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/diagnostic"
+	"github.com/cndoit18/lox/token"
+)
+
+// WithLoader enables import statements, using l to find modules.
+func WithLoader(l ast.Loader) Option {
+	return func(e *evaluator) {
+		e.loader = l
+	}
+}
+
+// loxModule is an imported file. Each module has its own globals, whose
+// enclosing environment holds the natives shared by all modules.
+type loxModule struct {
+	// name is the path the module was first imported as.
+	name    string
+	file    string
+	globals *globalEnvironment
+	exports map[string]bool
+	// loading is set while the module body runs, to detect import cycles.
+	loading bool
+}
+
+func (m *loxModule) Get(name token.Token) any {
+	if !m.exports[name.Lexeme] {
+		panic(newRuntimeError(name, fmt.Sprintf("Module %s has no export '%s'.", builtin.Quote(m.name), name.Lexeme)))
+	}
+	return m.globals.Get(name)
+}
+
+func (m *loxModule) String() string {
+	return "<module " + m.name + ">"
+}
+
+func (i *evaluator) VisitorStmtImport(s *ast.StmtImport[any]) any {
+	if s == nil {
+		return nil
+	}
+
+	module := i.importModule(s.Path)
+	i.define(s.Name, module)
+	return nil
+}
+
+func (i *evaluator) VisitorStmtExport(s *ast.StmtExport[any]) any {
+	if s == nil {
+		return nil
+	}
+
+	if n := len(i.importing); n > 0 {
+		i.importing[n-1].exports[declaredName(s.Declaration).Lexeme] = true
+	}
+	return s.Declaration.Accept(i)
+}
+
+func declaredName(s ast.Stmt[any]) token.Token {
+	switch s := s.(type) {
+	case *ast.StmtFunction[any]:
+		return s.Name
+	case *ast.StmtClass[any]:
+		return s.Name
+	case *ast.StmtVar[any]:
+		return s.Name
+	}
+	panic(fmt.Sprintf("unexpected export of %T", s))
+}
+
+// importModule returns the module imported as path, running it first if
+// this is the first time it is imported.
+func (i *evaluator) importModule(path token.Token) *loxModule {
+	name := path.Literal.(string)
+	if i.loader == nil {
+		panic(newRuntimeError(path, "Modules are not supported here."))
+	}
+	importer := ""
+	if n := len(i.importing); n > 0 {
+		importer = i.importing[n-1].file
+	}
+	file, err := i.loader.Resolve(importer, name)
+	if err != nil {
+		panic(newImportError(path, name, file, err))
+	}
+	if module, ok := i.modules[file]; ok {
+		if module.loading {
+			panic(newRuntimeError(path, "Import cycle: "+i.cycle(module)+"."))
+		}
+		return module
+	}
+
+	stmts, err := i.loader.Load(file)
+	if err != nil {
+		panic(newImportError(path, name, file, err))
+	}
+	module := &loxModule{
+		name:    name,
+		file:    file,
+		globals: newGlobalEnvironment(i.builtins),
+		exports: map[string]bool{},
+		loading: true,
+	}
+	i.modules[file] = module
+	i.runModule(path, module, stmts)
+	module.loading = false
+	return module
+}
+
+// cycle describes the chain of imports from module back to itself.
+func (i *evaluator) cycle(module *loxModule) string {
+	names := []string{}
+	for n := len(i.importing) - 1; n >= 0; n-- {
+		names = append([]string{i.importing[n].name}, names...)
+		if i.importing[n] == module {
+			break
+		}
+	}
+	return strings.Join(append(names, module.name), " -> ")
+}
+
+// runModule resolves and executes the body of module with a resolver of
+// its own. Errors are reported at the import statement.
+func (i *evaluator) runModule(path token.Token, module *loxModule, stmts []ast.Stmt[any]) {
+	resolver := &Resolver{
+		interpreter: i,
+		scopes:      list.New(),
+	}
+	resolver.scopes.PushBack(newScope())
+
+	environment, frames := i.environment, len(i.frames)
+	i.environment = module.globals
+	i.importing = append(i.importing, module)
+	defer func() {
+		i.environment = environment
+		i.importing = i.importing[:len(i.importing)-1]
+		if r := recover(); r != nil {
+			err, ok := r.(*runtimeError)
+			if !ok {
+				panic(r)
+			}
+			i.frames = i.frames[:frames]
+			// a failed module is not cached, so importing it again retries.
+			delete(i.modules, module.file)
+			panic(newImportError(path, module.name, module.file, err))
+		}
+	}()
+	for _, stmt := range stmts {
+		stmt.Accept(resolver)
+	}
+	if i.compiled {
+		i.compileAndRun(stmts, module.globals)
+		return
+	}
+	for _, stmt := range stmts {
+		stmt.Accept(i)
+	}
+}
+
+// newImportError reports err, raised while loading file, at the import
+// statement. The positions of err are relative to file, so they are
+// listed as notes rather than rendered against the importing source.
+func newImportError(path token.Token, name, file string, err error) error {
+	notes := []string{}
+	for _, d := range diagnostic.Flatten(err) {
+		if r, ok := err.(*runtimeError); ok {
+			// the trace of a module error points into several files.
+			d.Notes = r.notes
+		}
+		if d.Span.Start.Line == 0 {
+			notes = append(notes, d.Message)
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("%s:%s: %s", file, d.Span.Start, d.Message))
+		notes = append(notes, d.Notes...)
+	}
+	var cause error
+	if r, ok := err.(*runtimeError); ok {
+		cause = r.cause
+	}
+	return &runtimeError{
+		token: path,
+		msg:   fmt.Sprintf("Can't import %s.", builtin.Quote(name)),
+		notes: notes,
+		cause: cause,
+	}
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/token"
+)
+
+// Variadic is the arity of a native function that accepts any number of arguments.
+const Variadic = builtin.Variadic
+
+// NativeFunc is the Go implementation of a native function. A non-nil error
+// is reported to the script as a runtime error at the call site.
+type NativeFunc = builtin.Func
+
+type nativeFunction struct {
+	name  string
+	arity int
+	fn    NativeFunc
+}
+
+// NewNative wraps a Go function so that it can be called from scripts.
+func NewNative(name string, arity int, fn NativeFunc) ast.Callable[any] {
+	return &nativeFunction{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+func (n *nativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *nativeFunction) Call(_ ast.ExprVisitor[any], params ...any) any {
+	value, err := n.fn(params...)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+func (n *nativeFunction) call(paren token.Token, params ...any) any {
+	value, err := n.fn(params...)
+	if err != nil {
+		panic(newRuntimeError(paren, err.Error()))
+	}
+	return value
+}
+
+// callNative calls native at paren and charges what it allocates.
+func (i *evaluator) callNative(native *nativeFunction, paren token.Token, args ...any) any {
+	before := builtin.Footprint(args...)
+	value := native.call(paren, args...)
+	if size := builtin.Allocated(before, value, args); size > 0 {
+		i.alloc(paren, size)
+	}
+	return value
+}
+
+func (n *nativeFunction) String() string {
+	return "<native fn " + n.name + ">"
+}
+
+// Define binds a value to a global name visible to the main script and
+// every module.
+func (r *Resolver) Define(name string, value any) {
+	r.interpreter.builtins.Set(token.Token{Type: token.IDENTIFIER, Lexeme: name}, value)
+}
+
+// DefineNative registers a Go function as a global function.
+func (r *Resolver) DefineNative(name string, arity int, fn NativeFunc) {
+	r.Define(name, NewNative(name, arity, fn))
+}
+
+// engine shows the values of the evaluator to the standard natives.
+var engine = builtin.Engine{TypeOf: typeOf, Equal: isEqual}
+
+func defineStandard(r *Resolver) {
+	engine.Define(r.DefineNative, r.interpreter.stdin)
+}
+
+// typeOf names the types of the values the evaluator adds to the builtin
+// ones.
+func typeOf(value any) string {
+	switch value.(type) {
+	case *loxClass:
+		return "class"
+	case *loxInstance:
+		return "instance"
+	case *loxModule:
+		return "module"
+	case ast.Callable[any]:
+		return "function"
+	}
+	return ""
+}
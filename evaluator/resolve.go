@@ -1,36 +1,189 @@
 package evaluator
 
 import (
+	"bufio"
 	"container/list"
+	"context"
+	"io"
+	"maps"
+	"os"
 
 	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/limit"
 	"github.com/cndoit18/lox/token"
 )
 
-type resolve struct {
-	interpreter *evaluator
-	scopes      *list.List
+type functionType int
+
+const (
+	functionNone functionType = iota
+	functionFunction
+	functionMethod
+	functionInitializer
+)
+
+type classType int
+
+const (
+	classNone classType = iota
+	classClass
+	classSubclass
+)
+
+type Resolver struct {
+	interpreter     *evaluator
+	scopes          *list.List
+	currentFunction functionType
+	currentClass    classType
+	// loops counts the loops enclosing the current statement within the
+	// current function.
+	loops int
+}
+
+// Option configures the evaluator created by New.
+type Option func(*evaluator)
+
+// WithStdout sets the writer used by print statements.
+func WithStdout(w io.Writer) Option {
+	return func(e *evaluator) {
+		e.stdout = w
+	}
+}
+
+// WithStdin sets the reader used by the input native.
+func WithStdin(r io.Reader) Option {
+	return func(e *evaluator) {
+		e.stdin = bufio.NewReader(r)
+	}
+}
+
+// WithBudget limits each run to steps loop iterations and calls. A run
+// that goes over fails with an error wrapping limit.ErrBudgetExceeded.
+func WithBudget(steps int) Option {
+	return func(e *evaluator) {
+		e.budget = steps
+	}
+}
+
+// WithMaxDepth sets the number of calls that can be nested before a call
+// fails with a stack overflow. Defaults to limit.DefaultMaxDepth.
+func WithMaxDepth(depth int) Option {
+	return func(e *evaluator) {
+		e.maxDepth = depth
+	}
 }
 
-func New() *resolve {
-	scope := list.New()
-	scope.PushBack(map[string]bool{})
-	return &resolve{
+// WithMemoryLimit limits each run to allocating about bytes bytes. A run
+// that goes over fails with an error wrapping limit.ErrMemoryExceeded.
+func WithMemoryLimit(bytes int) Option {
+	return func(e *evaluator) {
+		e.memory = bytes
+	}
+}
+
+func New(opts ...Option) *Resolver {
+	scopes := list.New()
+	scopes.PushBack(newScope())
+	builtins := newGlobalEnvironment(nil)
+	globals := newGlobalEnvironment(builtins)
+	r := &Resolver{
 		interpreter: &evaluator{
-			environment: NewEnvironment(nil),
-			locals:      make(map[ast.Expr[any]]int),
+			environment: globals,
+			builtins:    builtins,
+			globals:     globals,
+			locals:      make(map[ast.Expr[any]]binding),
+			modules:     map[string]*loxModule{},
+			maxDepth:    limit.DefaultMaxDepth,
+			stdout:      os.Stdout,
+			stdin:       bufio.NewReader(os.Stdin),
 		},
-		scopes: scope,
+		scopes: scopes,
+	}
+	for _, opt := range opts {
+		opt(r.interpreter)
 	}
+	defineStandard(r)
+	return r
 }
 
-func (r *resolve) Interpreter() *evaluator {
+func (r *Resolver) Interpreter() *evaluator {
 	return r.interpreter
 }
 
+// Allocated returns the approximate number of bytes allocated by the last
+// run.
+func (r *Resolver) Allocated() int {
+	return r.interpreter.meter.Allocated()
+}
+
+// Run resolves and then executes stmts, returning the value of the last
+// statement when that is an expression statement, and nil otherwise.
+// Errors raised while resolving or executing are returned instead of being
+// propagated as panics.
+func (r *Resolver) Run(stmts []ast.Stmt[any]) (any, error) {
+	return r.RunContext(context.Background(), stmts)
+}
+
+// RunContext is like Run, stopping the script with an error wrapping the
+// error of ctx once ctx is done. Loops and calls check ctx, so natives that
+// block are not interrupted.
+func (r *Resolver) RunContext(ctx context.Context, stmts []ast.Stmt[any]) (value any, err error) {
+	r.interpreter.meter = limit.NewMeter(ctx, r.interpreter.budget, r.interpreter.memory)
+	global, resolved := r.scopes.Front().Value.(*scope).clone(), false
+	defer func() {
+		if v := recover(); v != nil {
+			e, ok := v.(error)
+			if !ok {
+				panic(v)
+			}
+			if e, ok := e.(*runtimeError); ok && e.trace == nil {
+				e.trace = r.interpreter.traceback(e.token.Pos())
+			}
+			r.interpreter.frames = r.interpreter.frames[:0]
+			value, err = nil, e
+			// leave only the global scope so the next run starts clean.
+			for r.scopes.Len() > 1 {
+				r.endScope()
+			}
+			// the global scope as well, if stmts failed to resolve and
+			// declared names that were never defined.
+			if !resolved {
+				r.scopes.Front().Value = global
+			}
+			r.loops = 0
+			r.interpreter.environment = r.interpreter.globals
+		}
+	}()
+	for _, stmt := range stmts {
+		stmt.Accept(r)
+	}
+	resolved = true
+	if r.interpreter.compiled {
+		return r.interpreter.compileAndRun(stmts, r.interpreter.globals), nil
+	}
+	for n, stmt := range stmts {
+		if expr, ok := stmt.(*ast.StmtExpr[any]); ok && n == len(stmts)-1 {
+			return r.interpreter.evaluate(expr.Expression), nil
+		}
+		stmt.Accept(r.interpreter)
+	}
+	return nil, nil
+}
+
+// endsInExpression reports whether the last of stmts is an expression
+// statement, whose value is the value of a run.
+func endsInExpression(stmts []ast.Stmt[any]) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	_, ok := stmts[len(stmts)-1].(*ast.StmtExpr[any])
+	return ok
+}
+
 // VisitorStmtBlock implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtBlock(e *ast.StmtBlock[any]) any {
+func (r *Resolver) VisitorStmtBlock(e *ast.StmtBlock[any]) any {
 	r.beginScope()
+	r.hoist(e.Statements)
 	for _, stmt := range e.Statements {
 		stmt.Accept(r)
 	}
@@ -39,26 +192,74 @@ func (r *resolve) VisitorStmtBlock(e *ast.StmtBlock[any]) any {
 }
 
 // VisitorStmtExpr implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtExpr(e *ast.StmtExpr[any]) any {
+func (r *Resolver) VisitorStmtExpr(e *ast.StmtExpr[any]) any {
 	return e.Expression.Accept(r)
 }
 
 // VisitorStmtFunction implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtFunction(e *ast.StmtFunction[any]) any {
+func (r *Resolver) VisitorStmtFunction(e *ast.StmtFunction[any]) any {
+	r.declare(e.Name)
+	r.define(e.Name)
+	if r.scopes.Len() > 0 {
+		s := r.scopes.Back().Value.(*scope)
+		if s.hoisted[e.Name.Lexeme] == s.slots[e.Name.Lexeme] {
+			delete(s.hoisted, e.Name.Lexeme)
+		}
+	}
+	r.resolveFunction(e.Params, e.Body.(*ast.StmtBlock[any]), functionFunction)
+	return nil
+}
+
+// VisitorStmtClass implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtClass(e *ast.StmtClass[any]) any {
+	enclosingClass := r.currentClass
+	r.currentClass = classClass
+	defer func() { r.currentClass = enclosingClass }()
+
 	r.declare(e.Name)
 	r.define(e.Name)
-	r.resolveFunction(e)
+
+	if e.Superclass != nil {
+		if e.Superclass.Name.Lexeme == e.Name.Lexeme {
+			panic(newRuntimeError(e.Superclass.Name, "A class can't inherit from itself."))
+		}
+		r.currentClass = classSubclass
+		e.Superclass.Accept(r)
+
+		r.beginScope()
+		r.declare(superToken)
+		r.define(superToken)
+		defer r.endScope()
+	}
+
+	r.beginScope()
+	r.declare(thisToken)
+	r.define(thisToken)
+	for _, method := range e.Methods {
+		declaration := functionMethod
+		if method.Name.Lexeme == "init" {
+			declaration = functionInitializer
+		}
+		r.resolveFunction(method.Params, method.Body.(*ast.StmtBlock[any]), declaration)
+	}
+	r.endScope()
 	return nil
 }
 
-func (r *resolve) resolveFunction(e *ast.StmtFunction[any]) {
+func (r *Resolver) resolveFunction(params []token.Token, body *ast.StmtBlock[any], typ functionType) {
+	enclosingFunction, enclosingLoops := r.currentFunction, r.loops
+	r.currentFunction, r.loops = typ, 0
+	defer func() { r.currentFunction, r.loops = enclosingFunction, enclosingLoops }()
+
 	r.beginScope()
-	for _, param := range e.Params {
+	r.scopes.Back().Value.(*scope).function = true
+	for _, param := range params {
 		r.declare(param)
 		r.define(param)
 	}
 
-	for _, stmt := range e.Body.(*ast.StmtBlock[any]).Statements {
+	r.hoist(body.Statements)
+	for _, stmt := range body.Statements {
 		stmt.Accept(r)
 	}
 
@@ -66,7 +267,7 @@ func (r *resolve) resolveFunction(e *ast.StmtFunction[any]) {
 }
 
 // VisitorStmtIf implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtIf(e *ast.StmtIf[any]) any {
+func (r *Resolver) VisitorStmtIf(e *ast.StmtIf[any]) any {
 	e.Condition.Accept(r)
 	e.ThenBranch.Accept(r)
 	if e.ElseBranch != nil {
@@ -76,20 +277,52 @@ func (r *resolve) VisitorStmtIf(e *ast.StmtIf[any]) any {
 }
 
 // VisitorStmtPrint implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtPrint(e *ast.StmtPrint[any]) any {
+func (r *Resolver) VisitorStmtPrint(e *ast.StmtPrint[any]) any {
 	return e.Expression.Accept(r)
 }
 
 // VisitorStmtReturn implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtReturn(e *ast.StmtReturn[any]) any {
+func (r *Resolver) VisitorStmtReturn(e *ast.StmtReturn[any]) any {
+	if r.currentFunction == functionNone {
+		panic(newRuntimeError(e.Keyword, "Can't return from top-level code."))
+	}
 	if e.Value != nil {
+		if r.currentFunction == functionInitializer {
+			panic(newRuntimeError(e.Keyword, "Can't return a value from an initializer."))
+		}
 		e.Value.Accept(r)
 	}
 	return nil
 }
 
+// VisitorStmtThrow implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtThrow(e *ast.StmtThrow[any]) any {
+	return e.Value.Accept(r)
+}
+
+// VisitorStmtTry implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtTry(e *ast.StmtTry[any]) any {
+	e.Body.Accept(r)
+	if e.Catch != nil {
+		// the caught value shares a scope with the catch body, as
+		// parameters do with a function body.
+		r.beginScope()
+		r.declare(e.Name)
+		r.define(e.Name)
+		r.hoist(e.Catch.Statements)
+		for _, stmt := range e.Catch.Statements {
+			stmt.Accept(r)
+		}
+		r.endScope()
+	}
+	if e.Finally != nil {
+		e.Finally.Accept(r)
+	}
+	return nil
+}
+
 // VisitorStmtVar implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtVar(e *ast.StmtVar[any]) any {
+func (r *Resolver) VisitorStmtVar(e *ast.StmtVar[any]) any {
 	r.declare(e.Name)
 	if e.Initializer != nil {
 		e.Initializer.Accept(r)
@@ -99,28 +332,85 @@ func (r *resolve) VisitorStmtVar(e *ast.StmtVar[any]) any {
 }
 
 // VisitorStmtWhile implements ast.StmtVisitor.
-func (r *resolve) VisitorStmtWhile(e *ast.StmtWhile[any]) any {
+func (r *Resolver) VisitorStmtWhile(e *ast.StmtWhile[any]) any {
 	e.Condition.Accept(r)
+	r.loops++
+	e.Body.Accept(r)
+	r.loops--
+	if e.Increment != nil {
+		e.Increment.Accept(r)
+	}
+	return nil
+}
+
+// VisitorStmtForIn implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtForIn(e *ast.StmtForIn[any]) any {
+	e.Iterable.Accept(r)
+	r.beginScope()
+	r.declare(e.Name)
+	r.define(e.Name)
+	r.loops++
 	e.Body.Accept(r)
+	r.loops--
+	r.endScope()
+	return nil
+}
+
+// VisitorStmtImport implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtImport(e *ast.StmtImport[any]) any {
+	if !r.topLevel() {
+		panic(newRuntimeError(e.Keyword, "Can only import at the top level."))
+	}
+	r.declare(e.Name)
+	r.define(e.Name)
+	return nil
+}
+
+// VisitorStmtExport implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtExport(e *ast.StmtExport[any]) any {
+	if !r.topLevel() {
+		panic(newRuntimeError(e.Keyword, "Can only export at the top level."))
+	}
+	return e.Declaration.Accept(r)
+}
+
+// topLevel reports whether statements are resolved in the global scope.
+func (r *Resolver) topLevel() bool {
+	return r.scopes.Len() == 1 && r.currentFunction == functionNone
+}
+
+// VisitorStmtBreak implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtBreak(e *ast.StmtBreak[any]) any {
+	if r.loops == 0 {
+		panic(newRuntimeError(e.Keyword, "Can't use 'break' outside of a loop."))
+	}
+	return nil
+}
+
+// VisitorStmtContinue implements ast.StmtVisitor.
+func (r *Resolver) VisitorStmtContinue(e *ast.StmtContinue[any]) any {
+	if r.loops == 0 {
+		panic(newRuntimeError(e.Keyword, "Can't use 'continue' outside of a loop."))
+	}
 	return nil
 }
 
 // VisitorExprAssign implements ast.ExprVisitor.
-func (r *resolve) VisitorExprAssign(e *ast.ExprAssign[any]) any {
+func (r *Resolver) VisitorExprAssign(e *ast.ExprAssign[any]) any {
 	e.Value.Accept(r)
 	r.resolveLocal(e, e.Name)
 	return nil
 }
 
 // VisitorExprBinary implements ast.ExprVisitor.
-func (r *resolve) VisitorExprBinary(e *ast.ExprBinary[any]) any {
+func (r *Resolver) VisitorExprBinary(e *ast.ExprBinary[any]) any {
 	e.Left.Accept(r)
 	e.Right.Accept(r)
 	return nil
 }
 
 // VisitorExprCall implements ast.ExprVisitor.
-func (r *resolve) VisitorExprCall(e *ast.ExprCall[any]) any {
+func (r *Resolver) VisitorExprCall(e *ast.ExprCall[any]) any {
 	e.Callee.Accept(r)
 	for _, argument := range e.Arguments {
 		argument.Accept(r)
@@ -129,32 +419,102 @@ func (r *resolve) VisitorExprCall(e *ast.ExprCall[any]) any {
 }
 
 // VisitorExprGrouping implements ast.ExprVisitor.
-func (r *resolve) VisitorExprGrouping(e *ast.ExprGrouping[any]) any {
+func (r *Resolver) VisitorExprGrouping(e *ast.ExprGrouping[any]) any {
 	return e.Expression.Accept(r)
 }
 
 // VisitorExprLiteral implements ast.ExprVisitor.
-func (*resolve) VisitorExprLiteral(*ast.ExprLiteral[any]) any {
+func (*Resolver) VisitorExprLiteral(*ast.ExprLiteral[any]) any {
 	return nil
 }
 
 // VisitorExprLogical implements ast.ExprVisitor.
-func (r *resolve) VisitorExprLogical(e *ast.ExprLogical[any]) any {
+func (r *Resolver) VisitorExprLogical(e *ast.ExprLogical[any]) any {
 	e.Left.Accept(r)
 	e.Right.Accept(r)
 	return nil
 }
 
+// VisitorExprGet implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprGet(e *ast.ExprGet[any]) any {
+	return e.Object.Accept(r)
+}
+
+// VisitorExprSet implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprSet(e *ast.ExprSet[any]) any {
+	e.Value.Accept(r)
+	e.Object.Accept(r)
+	return nil
+}
+
+// VisitorExprSuper implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprSuper(e *ast.ExprSuper[any]) any {
+	if r.currentClass == classNone {
+		panic(newRuntimeError(e.Keyword, "Can't use 'super' outside of a class."))
+	} else if r.currentClass != classSubclass {
+		panic(newRuntimeError(e.Keyword, "Can't use 'super' in a class with no superclass."))
+	}
+	r.resolveLocal(e, e.Keyword)
+	return nil
+}
+
+// VisitorExprThis implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprThis(e *ast.ExprThis[any]) any {
+	if r.currentClass == classNone {
+		panic(newRuntimeError(e.Keyword, "Can't use 'this' outside of a class."))
+	}
+	r.resolveLocal(e, e.Keyword)
+	return nil
+}
+
+// VisitorExprList implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprList(e *ast.ExprList[any]) any {
+	for _, element := range e.Elements {
+		element.Accept(r)
+	}
+	return nil
+}
+
+// VisitorExprFunction implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprFunction(e *ast.ExprFunction[any]) any {
+	r.resolveFunction(e.Params, e.Body, functionFunction)
+	return nil
+}
+
+// VisitorExprMap implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprMap(e *ast.ExprMap[any]) any {
+	for i, key := range e.Keys {
+		key.Accept(r)
+		e.Values[i].Accept(r)
+	}
+	return nil
+}
+
+// VisitorExprIndex implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprIndex(e *ast.ExprIndex[any]) any {
+	e.Object.Accept(r)
+	e.Index.Accept(r)
+	return nil
+}
+
+// VisitorExprIndexSet implements ast.ExprVisitor.
+func (r *Resolver) VisitorExprIndexSet(e *ast.ExprIndexSet[any]) any {
+	e.Object.Accept(r)
+	e.Index.Accept(r)
+	e.Value.Accept(r)
+	return nil
+}
+
 // VisitorExprUnary implements ast.ExprVisitor.
-func (r *resolve) VisitorExprUnary(e *ast.ExprUnary[any]) any {
+func (r *Resolver) VisitorExprUnary(e *ast.ExprUnary[any]) any {
 	e.Right.Accept(r)
 	return nil
 }
 
 // VisitorExprVariable implements ast.ExprVisitor.
-func (r *resolve) VisitorExprVariable(e *ast.ExprVariable[any]) any {
+func (r *Resolver) VisitorExprVariable(e *ast.ExprVariable[any]) any {
 	if r.scopes.Len() > 0 {
-		if v, ok := r.scopes.Back().Value.(map[string]bool)[e.Name.Lexeme]; ok && !v {
+		if v, ok := r.scopes.Back().Value.(*scope).defined[e.Name.Lexeme]; ok && !v {
 			panic(newRuntimeError(e.Name, "Can't read local variable in its own initializer."))
 		}
 	}
@@ -162,11 +522,39 @@ func (r *resolve) VisitorExprVariable(e *ast.ExprVariable[any]) any {
 	return nil
 }
 
-func (r *resolve) beginScope() {
-	r.scopes.PushBack(map[string]bool{})
+// scope is a block being resolved. Its variables get consecutive slots in
+// the order they are declared, which is the order the evaluator defines
+// them in.
+type scope struct {
+	slots   map[string]int
+	defined map[string]bool
+	size    int
+	// hoisted holds the slots of the functions the block declares further
+	// down, which the bodies of functions declared before them can call.
+	hoisted map[string]int
+	// function is set for the scope of a function's parameters and body.
+	function bool
+}
+
+func newScope() *scope {
+	return &scope{slots: map[string]int{}, defined: map[string]bool{}, hoisted: map[string]int{}}
+}
+
+func (s *scope) clone() *scope {
+	return &scope{
+		slots:    maps.Clone(s.slots),
+		defined:  maps.Clone(s.defined),
+		size:     s.size,
+		hoisted:  maps.Clone(s.hoisted),
+		function: s.function,
+	}
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes.PushBack(newScope())
 }
 
-func (r *resolve) endScope() {
+func (r *Resolver) endScope() {
 	if r.scopes.Len() == 0 {
 		return
 	}
@@ -174,27 +562,73 @@ func (r *resolve) endScope() {
 	r.scopes.Remove(r.scopes.Back())
 }
 
-func (r *resolve) declare(name token.Token) {
+func (r *Resolver) declare(name token.Token) {
 	if r.scopes.Len() == 0 {
 		return
 	}
 
-	r.scopes.Back().Value.(map[string]bool)[name.Lexeme] = false
+	s := r.scopes.Back().Value.(*scope)
+	// a variable declared again gets a new slot, as the evaluator defines
+	// it again.
+	s.slots[name.Lexeme] = s.size
+	s.size++
+	s.defined[name.Lexeme] = false
 }
 
-func (r *resolve) define(name token.Token) {
+// hoist records the slots the functions that stmts declare in the current
+// local scope will get, so that functions declared before them can call
+// them: mutually recursive functions can be declared in any order.
+func (r *Resolver) hoist(stmts []ast.Stmt[any]) {
+	s := r.scopes.Back().Value.(*scope)
+	slot := s.size
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.StmtFunction[any]:
+			if _, ok := s.hoisted[stmt.Name.Lexeme]; !ok {
+				s.hoisted[stmt.Name.Lexeme] = slot
+			}
+			slot++
+		case *ast.StmtVar[any], *ast.StmtClass[any], *ast.StmtImport[any]:
+			slot++
+		}
+	}
+}
+
+func (r *Resolver) define(name token.Token) {
 	if r.scopes.Len() == 0 {
 		return
 	}
 
-	r.scopes.Back().Value.(map[string]bool)[name.Lexeme] = true
+	r.scopes.Back().Value.(*scope).defined[name.Lexeme] = true
 }
 
-func (r *resolve) resolveLocal(expr ast.Expr[any], name token.Token) {
-	for i, current := 0, r.scopes.Back(); current != nil; current, i = current.Prev(), i+1 {
-		if current.Value.(map[string]bool)[name.Lexeme] {
-			r.interpreter.resolve(expr, i)
-			return
+// resolveLocal records the slot of the local that name refers to. Names
+// declared in the global scope, or nowhere, are looked up by name.
+func (r *Resolver) resolveLocal(expr ast.Expr[any], name token.Token) {
+	if b := r.lookup(r.scopes.Back(), 0, name.Lexeme, false); b != nil {
+		r.interpreter.locals[expr] = *b
+	}
+}
+
+// lookup finds the local called name from the scope current, depth scopes
+// below the one expr is in, or returns nil for a global. Code in a block
+// only sees the functions declared above it; the body of a function also
+// sees those its enclosing blocks declare further down, as it can run
+// after they are, through a hoisted binding.
+func (r *Resolver) lookup(current *list.Element, depth int, name string, inFunction bool) *binding {
+	for ; current != r.scopes.Front(); current, depth = current.Prev(), depth+1 {
+		s := current.Value.(*scope)
+		if slot, ok := s.hoisted[name]; ok && inFunction {
+			outer := r.lookup(current.Prev(), depth+1, name, true)
+			if slot, ok := s.slots[name]; ok {
+				outer = &binding{depth: depth, slot: slot}
+			}
+			return &binding{depth: depth, slot: slot, hoisted: true, outer: outer}
 		}
+		if slot, ok := s.slots[name]; ok {
+			return &binding{depth: depth, slot: slot}
+		}
+		inFunction = inFunction || s.function
 	}
+	return nil
 }
@@ -1,47 +1,124 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 
 	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/diagnostic"
+	"github.com/cndoit18/lox/limit"
+	"github.com/cndoit18/lox/token"
 )
 
+var (
+	thisToken  = token.Token{Type: token.THIS, Lexeme: "this"}
+	superToken = token.Token{Type: token.SUPER, Lexeme: "super"}
+)
+
+// lambdaName is the name anonymous functions are reported under.
+const lambdaName = "lambda"
+
 type warpperFunction struct {
-	fun *ast.StmtFunction[any]
+	name          string
+	params        []token.Token
+	body          *ast.StmtBlock[any]
+	closure       Environment
+	isInitializer bool
+	// unbound and receiver are set for a method bound to an instance.
+	unbound  method
+	receiver *loxInstance
 }
 
 func (w *warpperFunction) Arity() int {
-	return len(w.fun.Params)
+	return len(w.params)
 }
 
-func (w *warpperFunction) Call(v ast.ExprVisitor[any], params ...any) (ret any) {
-	defer func() {
-		if r := recover(); r != nil {
-			if v, ok := r.(returnObject); ok {
-				ret = v.Value
-			} else {
-				panic(r)
-			}
-		}
-	}()
+func (w *warpperFunction) Call(v ast.ExprVisitor[any], params ...any) any {
 	c := v.(*evaluator)
-	environment := NewEnvironment(c.environment)
-	for i, param := range w.fun.Params {
+	environment := NewEnvironment(w.closure)
+	for i, param := range w.params {
 		environment.Set(param, params[i])
 	}
 
-	return c.executeBlock(w.fun.Body.(*ast.StmtBlock[any]), environment)
+	result := c.executeBlock(w.body, environment)
+	if w.isInitializer {
+		return w.closure.GetAt(0, 0, thisToken)
+	}
+	if result, ok := result.(abrupt); ok {
+		return result.value
+	}
+	return nil
 }
 
-func WrapperFunction(s *ast.StmtFunction[any]) ast.Callable[any] {
+func (w *warpperFunction) bind(instance *loxInstance) ast.Callable[any] {
+	environment := NewEnvironment(w.closure)
+	environment.Set(thisToken, instance)
 	return &warpperFunction{
-		fun: s,
+		name:          w.name,
+		params:        w.params,
+		body:          w.body,
+		closure:       environment,
+		isInitializer: w.isInitializer,
+		unbound:       w,
+		receiver:      instance,
 	}
 }
 
+func (w *warpperFunction) String() string {
+	return "<fn " + w.name + ">"
+}
+
+// WrapperFunction creates a function that closes over the environment
+// it was declared in.
+func WrapperFunction(s *ast.StmtFunction[any], closure Environment) ast.Callable[any] {
+	return newFunction(s, closure)
+}
+
+func newFunction(s *ast.StmtFunction[any], closure Environment) *warpperFunction {
+	return &warpperFunction{
+		name:    s.Name.Lexeme,
+		params:  s.Params,
+		body:    s.Body.(*ast.StmtBlock[any]),
+		closure: closure,
+	}
+}
+
+// frame is a function call in progress.
+type frame struct {
+	function string
+	// call is where the call expression starts.
+	call token.Position
+}
+
 type evaluator struct {
 	environment Environment
-	locals      map[ast.Expr[any]]int
+	// frames are pushed by calls and only popped when a call returns
+	// normally, so they still describe the stack when an error unwinds it.
+	frames []frame
+	// builtins encloses the globals of the main script and of every module.
+	builtins *globalEnvironment
+	globals  *globalEnvironment
+	locals   map[ast.Expr[any]]binding
+	// compiled runs statements through the closure compiler.
+	compiled bool
+	// budget is the number of steps each run may take, or zero for no
+	// limit.
+	budget int
+	// memory is the number of bytes each run may allocate, or zero for no
+	// limit.
+	memory int
+	meter  limit.Meter
+	// maxDepth is the number of calls that can be nested.
+	maxDepth int
+
+	stdout io.Writer
+	stdin  *bufio.Reader
+
+	loader  ast.Loader
+	modules map[string]*loxModule
+	// importing is the stack of modules whose bodies are running.
+	importing []*loxModule
 }
 
 func (i *evaluator) VisitorStmtExpr(s *ast.StmtExpr[any]) any {
@@ -49,7 +126,8 @@ func (i *evaluator) VisitorStmtExpr(s *ast.StmtExpr[any]) any {
 		return nil
 	}
 
-	return i.evaluate(s.Expression)
+	i.evaluate(s.Expression)
+	return nil
 }
 
 func (i *evaluator) VisitorStmtPrint(s *ast.StmtPrint[any]) any {
@@ -57,7 +135,7 @@ func (i *evaluator) VisitorStmtPrint(s *ast.StmtPrint[any]) any {
 		return nil
 	}
 	value := i.evaluate(s.Expression)
-	fmt.Print(value)
+	fmt.Fprint(i.stdout, value)
 	return nil
 }
 
@@ -65,7 +143,7 @@ func (i *evaluator) VisitorStmtVar(s *ast.StmtVar[any]) any {
 	if s == nil {
 		return nil
 	}
-	i.environment.Set(s.Name, i.evaluate(s.Initializer))
+	i.define(s.Name, i.evaluate(s.Initializer))
 	return nil
 }
 
@@ -77,14 +155,20 @@ func (i *evaluator) VisitorStmtBlock(s *ast.StmtBlock[any]) any {
 	return i.executeBlock(s, NewEnvironment(i.environment))
 }
 
-func (i *evaluator) executeBlock(s *ast.StmtBlock[any], e Environment) any {
+// executeBlock runs the statements of s in e until one of them completes
+// abruptly, and returns what that one returned. The environment is not
+// restored when an error unwinds the block: whoever recovers the error
+// does that.
+func (i *evaluator) executeBlock(s *ast.StmtBlock[any], e Environment) (result any) {
 	original := i.environment
 	i.environment = e
-	defer func() { i.environment = original }()
 	for _, stmt := range s.Statements {
-		stmt.Accept(i)
+		if result = stmt.Accept(i); result != nil {
+			break
+		}
 	}
-	return nil
+	i.environment = original
+	return result
 }
 
 func (i *evaluator) VisitorStmtIf(s *ast.StmtIf[any]) any {
@@ -106,17 +190,99 @@ func (i *evaluator) VisitorStmtFunction(s *ast.StmtFunction[any]) any {
 	if s == nil {
 		return nil
 	}
-	function := WrapperFunction(s)
-	i.environment.Set(s.Name, function)
+	i.alloc(s.Name, limit.ObjectSize)
+	i.define(s.Name, WrapperFunction(s, i.environment))
 	return nil
 }
 
+func (i *evaluator) VisitorStmtClass(s *ast.StmtClass[any]) any {
+	if s == nil {
+		return nil
+	}
+	var superclass *loxClass
+	closure := i.environment
+	if s.Superclass != nil {
+		class, ok := i.evaluate(s.Superclass).(*loxClass)
+		if !ok {
+			panic(newRuntimeError(s.Superclass.Name, "Superclass must be a class."))
+		}
+		superclass = class
+		closure = NewEnvironment(closure)
+		closure.Set(superToken, superclass)
+	}
+
+	i.alloc(s.Name, limit.ObjectSize*(1+len(s.Methods)))
+	methods := map[string]method{}
+	for _, method := range s.Methods {
+		function := newFunction(method, closure)
+		function.isInitializer = method.Name.Lexeme == "init"
+		methods[method.Name.Lexeme] = function
+	}
+	i.define(s.Name, &loxClass{
+		name:       s.Name.Lexeme,
+		superclass: superclass,
+		methods:    methods,
+	})
+	return nil
+}
+
+func (i *evaluator) VisitorStmtThrow(s *ast.StmtThrow[any]) any {
+	if s == nil {
+		return nil
+	}
+	panic(newThrowError(s.Keyword, i.evaluate(s.Value)))
+}
+
+func (i *evaluator) VisitorStmtTry(s *ast.StmtTry[any]) (result any) {
+	if s == nil {
+		return nil
+	}
+	original, frames := i.environment, len(i.frames)
+	if s.Finally != nil {
+		defer func() {
+			r := recover()
+			if interrupted(r) {
+				panic(r)
+			}
+			i.environment = original
+			i.unwind(r, frames)
+			// a finally block that returns or leaves a loop overrides the
+			// outcome of the try statement, errors included.
+			if finally := s.Finally.Accept(i); finally != nil {
+				result = finally
+				return
+			}
+			if r != nil {
+				panic(r)
+			}
+		}()
+	}
+
+	defer func() {
+		if s.Catch == nil {
+			return
+		}
+		if r := recover(); r != nil {
+			err, ok := r.(*runtimeError)
+			if !ok || err.cause != nil {
+				panic(r)
+			}
+			// unwind the calls and scopes entered inside the try block.
+			i.frames, i.environment = i.frames[:frames], original
+			environment := NewEnvironment(i.environment)
+			environment.Set(s.Name, err.caught())
+			result = i.executeBlock(s.Catch, environment)
+		}
+	}()
+	return s.Body.Accept(i)
+}
+
 func (i *evaluator) VisitorStmtReturn(s *ast.StmtReturn[any]) any {
 	if s == nil {
 		return nil
 	}
 
-	panic(returnObject{Value: i.evaluate(s.Value)})
+	return abrupt{completion: completionReturn, value: i.evaluate(s.Value)}
 }
 
 func (i *evaluator) VisitorStmtWhile(s *ast.StmtWhile[any]) any {
@@ -125,16 +291,165 @@ func (i *evaluator) VisitorStmtWhile(s *ast.StmtWhile[any]) any {
 	}
 
 	for isTruthy(i.evaluate(s.Condition)) {
-		s.Body.Accept(i)
+		if result, exit := exitLoop(s.Body.Accept(i)); exit {
+			return result
+		}
+		if s.Increment != nil {
+			i.evaluate(s.Increment)
+		}
+		i.step(s.Keyword)
+	}
+	return nil
+}
 
+func (i *evaluator) VisitorStmtForIn(s *ast.StmtForIn[any]) any {
+	if s == nil {
+		return nil
+	}
+
+	next := i.iterate(s.Keyword, i.evaluate(s.Iterable))
+	original := i.environment
+	for {
+		value, ok := next()
+		if !ok {
+			break
+		}
+		// every iteration gets its own variable, so closures created in
+		// the body capture the element they were created for.
+		i.environment = NewEnvironment(original)
+		i.environment.Set(s.Name, value)
+		result := s.Body.Accept(i)
+		i.environment = original
+		if result, exit := exitLoop(result); exit {
+			return result
+		}
+		i.step(s.Keyword)
 	}
 	return nil
 }
 
-func (i *evaluator) resolve(e ast.Expr[any], depth int) {
-	i.locals[e] = depth
+// unwind pops the frames of the calls that r, recovered by a try
+// statement, cut short, leaving the first n. When r is an error that will
+// be raised again, its trace is taken first so that it still shows them.
+func (i *evaluator) unwind(r any, n int) {
+	if err, ok := r.(*runtimeError); ok && err.trace == nil {
+		err.trace = i.traceback(err.token.Pos())
+	}
+	i.frames = i.frames[:n]
+}
+
+// enter pushes the frame of a call to function starting at call. Calls
+// nested deeper than maxDepth raise a stack overflow at at instead.
+func (i *evaluator) enter(at token.Token, function ast.Callable[any], call token.Position) {
+	if len(i.frames) >= i.maxDepth {
+		panic(newRuntimeError(at, "Stack overflow."))
+	}
+	i.frames = append(i.frames, frame{function: functionName(function), call: call})
+}
+
+// alloc charges size bytes allocated at at, and stops the script when the
+// run goes over its memory limit.
+func (i *evaluator) alloc(at token.Token, size int) {
+	if err := i.meter.Alloc(size); err != nil {
+		panic(newInterruptError(at, err))
+	}
+}
+
+// define binds name to value in the current scope. Globals are charged
+// for, as they outlive the statement; locals go away with their scope,
+// unless a function captures it, which is charged for with the function.
+func (i *evaluator) define(name token.Token, value any) {
+	if _, ok := i.environment.(*globalEnvironment); ok {
+		i.alloc(name, limit.SlotSize)
+	}
+	i.environment.Set(name, value)
+}
+
+// callSize approximates what a call to function allocates that outlives
+// the call: the instance, when function is a class. The environment of
+// the call goes away when it returns.
+func callSize(function ast.Callable[any]) int {
+	if _, ok := function.(*loxClass); ok {
+		return limit.ObjectSize
+	}
+	return 0
+}
+
+// step counts a loop iteration or call made at at, and stops the script
+// when the limits of the run are reached.
+func (i *evaluator) step(at token.Token) {
+	if err := i.meter.Step(); err != nil {
+		panic(newInterruptError(at, err))
+	}
+}
+
+func (i *evaluator) VisitorStmtBreak(s *ast.StmtBreak[any]) any {
+	return breakResult
 }
 
-type returnObject struct {
-	Value any
+func (i *evaluator) VisitorStmtContinue(s *ast.StmtContinue[any]) any {
+	return continueResult
 }
+
+// exitLoop takes what an iteration of a loop body returned, and reports
+// whether the loop stops and what it returns then: nothing after a break,
+// and a return, which is passed on to the function.
+func exitLoop(result any) (any, bool) {
+	switch result, _ := result.(abrupt); result.completion {
+	case completionBreak:
+		return nil, true
+	case completionReturn:
+		return result, true
+	}
+	return nil, false
+}
+
+// traceback snapshots the call stack for an error raised at at.
+func (i *evaluator) traceback(at token.Position) diagnostic.Trace {
+	if len(i.frames) == 0 {
+		return nil
+	}
+	trace := diagnostic.Trace{}
+	for n := len(i.frames) - 1; n >= 0; n-- {
+		trace = append(trace, diagnostic.Frame{Function: i.frames[n].function, Pos: at})
+		at = i.frames[n].call
+	}
+	return append(trace, diagnostic.Frame{Pos: at})
+}
+
+// binding locates a local variable: the number of scopes between its use
+// and its declaration, and its slot in the declaring scope.
+type binding struct {
+	depth, slot int
+	// hoisted is set for a function declared further down its block. Until
+	// its declaration runs, the name refers to outer, or to a global when
+	// outer is nil.
+	hoisted bool
+	outer   *binding
+}
+
+// completion tells the enclosing statements how a statement finished. A
+// statement that completes abruptly cuts the statements enclosing it
+// short, until its completion reaches the call or loop it is meant for.
+type completion int
+
+const (
+	completionNormal completion = iota
+	completionBreak
+	completionContinue
+	completionReturn
+)
+
+// abrupt is what the tree walker's statements return when they complete
+// abruptly, with the value of a return statement. Statements that complete
+// normally return nil.
+type abrupt struct {
+	completion completion
+	value      any
+}
+
+// breakResult and continueResult are boxed once, as they carry no value.
+var (
+	breakResult    any = abrupt{completion: completionBreak}
+	continueResult any = abrupt{completion: completionContinue}
+)
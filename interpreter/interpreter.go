@@ -0,0 +1,362 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/diagnostic"
+	"github.com/cndoit18/lox/evaluator"
+	"github.com/cndoit18/lox/limit"
+	"github.com/cndoit18/lox/parser"
+	"github.com/cndoit18/lox/scanner"
+	"github.com/cndoit18/lox/vm"
+)
+
+// Value is a Lox value as seen from Go.
+type Value = any
+
+// ErrBudgetExceeded is wrapped by the error of a run that went over the
+// budget set by WithBudget.
+var ErrBudgetExceeded = limit.ErrBudgetExceeded
+
+// ErrMemoryExceeded is wrapped by the error of a run that allocated more
+// than WithMemoryLimit allows.
+var ErrMemoryExceeded = limit.ErrMemoryExceeded
+
+// Backend selects how an Interpreter executes programs.
+type Backend int
+
+const (
+	// TreeWalker evaluates the syntax tree directly.
+	TreeWalker Backend = iota
+	// VM compiles programs to bytecode for a stack-based virtual machine.
+	VM
+	// Closure compiles the syntax tree into Go closures and runs those.
+	Closure
+)
+
+func (b Backend) String() string {
+	switch b {
+	case VM:
+		return "vm"
+	case Closure:
+		return "closure"
+	}
+	return "tree"
+}
+
+// ParseBackend returns the backend called name: "tree", "closure" or "vm".
+func ParseBackend(name string) (Backend, error) {
+	for _, b := range []Backend{TreeWalker, Closure, VM} {
+		if b.String() == name {
+			return b, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown backend %q", name)
+}
+
+// engine executes parsed programs for an Interpreter.
+type engine interface {
+	RunContext(ctx context.Context, stmts []ast.Stmt[any]) (any, error)
+	Define(name string, value any)
+	DefineNative(name string, arity int, fn evaluator.NativeFunc)
+	Allocated() int
+}
+
+// Interpreter runs Lox source code. It is not safe for concurrent use.
+type Interpreter struct {
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+	// color forces colored diagnostics on or off; nil detects a terminal.
+	color *bool
+	// path lists the directories searched for modules that are not found
+	// next to the importing file.
+	path    []string
+	backend Backend
+	budget  int
+	memory  int
+	timeout time.Duration
+	// maxDepth is the number of calls that can be nested, or zero for
+	// limit.DefaultMaxDepth.
+	maxDepth int
+
+	engine engine
+	// file and source are those of the last evaluation, used by Report.
+	file   string
+	source []byte
+}
+
+type Option func(*Interpreter)
+
+// WithStdout sets the writer used by print statements. Defaults to os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stdout = w
+	}
+}
+
+// WithStderr sets the writer used by Report. Defaults to os.Stderr.
+// Diagnostics are colored when it is a terminal.
+func WithStderr(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.stderr = w
+	}
+}
+
+// WithStdin sets the reader used by the input native. Defaults to os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(i *Interpreter) {
+		i.stdin = r
+	}
+}
+
+// WithColor forces colored diagnostics on or off.
+func WithColor(enabled bool) Option {
+	return func(i *Interpreter) {
+		i.color = &enabled
+	}
+}
+
+// WithBackend selects the backend that executes programs. Defaults to
+// TreeWalker.
+func WithBackend(b Backend) Option {
+	return func(i *Interpreter) {
+		i.backend = b
+	}
+}
+
+// WithBudget limits each evaluation to steps loop iterations and function
+// calls. An evaluation that goes over stops with an error wrapping
+// ErrBudgetExceeded. Zero means no limit, the default.
+func WithBudget(steps int) Option {
+	return func(i *Interpreter) {
+		i.budget = steps
+	}
+}
+
+// WithMemoryLimit limits each evaluation to allocating about bytes bytes
+// of what can outlive the statement creating it: strings, collections,
+// instances, functions with the variables they capture, and globals.
+// Every backend charges the same. An evaluation that goes over stops with
+// an error wrapping ErrMemoryExceeded. What is allocated counts even once
+// it is no longer used. Zero means no limit, the default.
+func WithMemoryLimit(bytes int) Option {
+	return func(i *Interpreter) {
+		i.memory = bytes
+	}
+}
+
+// WithTimeout limits the time each evaluation may run. An evaluation that
+// goes over stops with an error wrapping context.DeadlineExceeded, as when
+// the context passed to Eval is done. Zero means no limit, the default.
+func WithTimeout(d time.Duration) Option {
+	return func(i *Interpreter) {
+		i.timeout = d
+	}
+}
+
+// WithMaxDepth sets the number of calls that can be nested. A call nested
+// deeper fails with a "Stack overflow." runtime error instead of crashing
+// the process. Defaults to 10000.
+func WithMaxDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxDepth = depth
+	}
+}
+
+// WithPath adds directories to search for imported modules.
+func WithPath(dirs ...string) Option {
+	return func(i *Interpreter) {
+		i.path = append(i.path, dirs...)
+	}
+}
+
+func New(opts ...Option) *Interpreter {
+	i := &Interpreter{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		stdin:  os.Stdin,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.maxDepth == 0 {
+		i.maxDepth = limit.DefaultMaxDepth
+	}
+	if i.color == nil {
+		color := diagnostic.IsTerminal(i.stderr)
+		i.color = &color
+	}
+	switch i.backend {
+	case VM:
+		i.engine = vm.New(
+			vm.WithStdout(i.stdout),
+			vm.WithStdin(i.stdin),
+			vm.WithLoader(loader{i}),
+			vm.WithBudget(i.budget),
+			vm.WithMemoryLimit(i.memory),
+			vm.WithMaxDepth(i.maxDepth),
+		)
+	default:
+		opts := []evaluator.Option{
+			evaluator.WithStdout(i.stdout),
+			evaluator.WithStdin(i.stdin),
+			evaluator.WithLoader(loader{i}),
+			evaluator.WithBudget(i.budget),
+			evaluator.WithMemoryLimit(i.memory),
+			evaluator.WithMaxDepth(i.maxDepth),
+		}
+		if i.backend == Closure {
+			opts = append(opts, evaluator.WithClosureCompiler())
+		}
+		i.engine = evaluator.New(opts...)
+	}
+	return i
+}
+
+// Define binds a value to a global name.
+func (i *Interpreter) Define(name string, value Value) {
+	i.engine.Define(name, value)
+}
+
+// DefineNative registers a Go function as a global function. Use
+// evaluator.Variadic as arity to accept any number of arguments.
+func (i *Interpreter) DefineNative(name string, arity int, fn evaluator.NativeFunc) {
+	i.engine.DefineNative(name, arity, fn)
+}
+
+// Allocated returns the approximate number of bytes allocated by the last
+// evaluation, which WithMemoryLimit bounds.
+func (i *Interpreter) Allocated() int {
+	return i.engine.Allocated()
+}
+
+// Eval scans, parses and executes src. Globals defined by earlier calls
+// remain visible. It returns the value of the last top-level statement,
+// which is nil unless that statement is an expression. Once ctx is done,
+// the script stops at its next loop iteration or call, with an error
+// wrapping ctx.Err().
+func (i *Interpreter) Eval(ctx context.Context, src string) (Value, error) {
+	return i.eval(ctx, "", []byte(src))
+}
+
+// EvalFile is like Eval, reading the source from the file at path.
+func (i *Interpreter) EvalFile(ctx context.Context, path string) (Value, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return i.eval(ctx, path, src)
+}
+
+func (i *Interpreter) eval(ctx context.Context, file string, src []byte) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	i.file, i.source = file, src
+
+	stmts, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+	return i.engine.RunContext(ctx, stmts)
+}
+
+// Disassemble compiles the file at path to bytecode, as the VM backend
+// would, and writes the listing of every function to the configured stdout.
+func (i *Interpreter) Disassemble(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	i.file, i.source = path, src
+
+	stmts, err := parse(src)
+	if err != nil {
+		return err
+	}
+	function, err := vm.Compile(stmts)
+	if err != nil {
+		return err
+	}
+	vm.Disassemble(i.stdout, function)
+	return nil
+}
+
+func parse(src []byte) ([]ast.Stmt[any], error) {
+	scan, err := scanner.NewScanner(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	tokens := scan.ScanTokens()
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return parser.NewParser[any](tokens...).Parse()
+}
+
+// loader finds modules relative to the importing file, then in the
+// search path. The main script imports relative to its own file, or to
+// the working directory when it was not read from one.
+type loader struct {
+	*Interpreter
+}
+
+func (l loader) Resolve(importer, path string) (string, error) {
+	if importer == "" {
+		importer = l.file
+	}
+	dirs := append([]string{filepath.Dir(importer)}, l.path...)
+	if filepath.IsAbs(path) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		file := filepath.Join(dir, path)
+		info, err := os.Stat(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return file, err
+		}
+		if info.IsDir() {
+			return file, fmt.Errorf("%s is a directory.", file)
+		}
+		return file, nil
+	}
+	return "", fmt.Errorf("Module not found in %s.", strings.Join(dirs, ", "))
+}
+
+func (l loader) Load(file string) ([]ast.Stmt[any], error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parse(src)
+}
+
+// Report renders err to the configured stderr, quoting the source of the
+// last evaluation.
+func (i *Interpreter) Report(err error) {
+	renderer := &diagnostic.Renderer{
+		File:   i.file,
+		Source: i.source,
+		Color:  *i.color,
+	}
+	renderer.Render(i.stderr, err)
+}
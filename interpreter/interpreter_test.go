@@ -0,0 +1,572 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		stdin   string
+		want    Value
+		stdout  string
+		wantErr bool
+	}{
+		{
+			name: "value",
+			src:  "var x = 3; x * 2;",
+			want: float64(6),
+		},
+		{
+			name:   "print",
+			src:    `print "hello";`,
+			stdout: "hello",
+		},
+		{
+			name:   "input",
+			src:    `print input() + "!"; input();`,
+			stdin:  "first\nsecond\n",
+			stdout: "first!",
+			want:   "second",
+		},
+		{
+			name:    "runtime error",
+			src:     `print "a" - 1;`,
+			wantErr: true,
+		},
+		{
+			name:    "syntax error",
+			src:     `print ;`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			lox := New(WithStdout(stdout), WithStdin(strings.NewReader(tt.stdin)))
+			got, err := lox.Eval(context.Background(), tt.src)
+			if err != nil != tt.wantErr {
+				t.Errorf("Eval() error = %v, wantErr = %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Eval() got = %v, want = %v", got, tt.want)
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("Eval() stdout = %q, want = %q", stdout.String(), tt.stdout)
+			}
+		})
+	}
+}
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		t.Run(backend.String(), func(t *testing.T) {
+			lox := New(WithBackend(backend))
+			lox.DefineNative("double", 1, func(args ...any) (any, error) {
+				return args[0].(float64) * 2, nil
+			})
+			if _, err := lox.Eval(context.Background(), "var x = double(2);"); err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			// a failed evaluation leaves the globals in place.
+			if _, err := lox.Eval(context.Background(), "x = 3; nil();"); err == nil {
+				t.Fatalf("Eval() error = nil, want a runtime error")
+			}
+			got, err := lox.Eval(context.Background(), "x + 1;")
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != float64(4) {
+				t.Errorf("Eval() got = %v, want = %v", got, float64(4))
+			}
+		})
+	}
+}
+
+func TestEvalAfterResolveError(t *testing.T) {
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		t.Run(backend.String(), func(t *testing.T) {
+			lox := New(WithBackend(backend))
+			if _, err := lox.Eval(context.Background(), "var a = 1;"); err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			// a line that fails to resolve leaves no trace of what it declared.
+			if _, err := lox.Eval(context.Background(), "var a = this;"); err == nil {
+				t.Fatalf("Eval() error = nil, want a resolve error")
+			}
+			got, err := lox.Eval(context.Background(), "a;")
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != float64(1) {
+				t.Errorf("Eval() got = %v, want = %v", got, float64(1))
+			}
+		})
+	}
+}
+
+func TestEvalCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New().Eval(ctx, "print 1;"); err != context.Canceled {
+		t.Errorf("Eval() error = %v, want = %v", err, context.Canceled)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		opts    []Option
+		want    error
+		wantErr string
+	}{
+		{
+			name:    "budget",
+			src:     "while (true) {}",
+			opts:    []Option{WithBudget(100)},
+			want:    ErrBudgetExceeded,
+			wantErr: "1:1: error: Execution budget exceeded.",
+		},
+		{
+			name: "budget spent by calls",
+			src:  "func f() { f(); }\nf();",
+			opts: []Option{WithBudget(100)},
+			want: ErrBudgetExceeded,
+		},
+		{
+			name: "budget not caught",
+			src:  "while (true) { try { while (true) {} } catch (e) {} }",
+			opts: []Option{WithBudget(100)},
+			want: ErrBudgetExceeded,
+		},
+		{
+			name: "budget not discarded by finally",
+			src:  "func f() { try { while (true) {} } finally { return 1; } }\nf();",
+			opts: []Option{WithBudget(100)},
+			want: ErrBudgetExceeded,
+		},
+		{
+			name: "within budget",
+			src:  "for (var i = 0; i < 10; i = i + 1) {}",
+			opts: []Option{WithBudget(100)},
+		},
+		{
+			name:    "memory",
+			src:     "var s = \"x\";\nwhile (true) s = s + s;",
+			opts:    []Option{WithMemoryLimit(1 << 20)},
+			want:    ErrMemoryExceeded,
+			wantErr: "2:20: error: Memory limit exceeded.",
+		},
+		{
+			name: "memory allocated by natives",
+			src:  "var l = [];\nwhile (true) push(l, l);",
+			opts: []Option{WithMemoryLimit(1 << 20)},
+			want: ErrMemoryExceeded,
+		},
+		{
+			name: "memory not caught",
+			src:  "var s = \"x\";\nwhile (true) { try { s = s + s; } catch (e) {} }",
+			opts: []Option{WithMemoryLimit(1 << 20)},
+			want: ErrMemoryExceeded,
+		},
+		{
+			name: "within memory limit",
+			src:  "var s = \"a\" + \"b\";",
+			opts: []Option{WithMemoryLimit(1 << 20)},
+		},
+		{
+			name:    "timeout",
+			src:     "while (true) {}",
+			opts:    []Option{WithTimeout(time.Millisecond)},
+			want:    context.DeadlineExceeded,
+			wantErr: "1:1: error: Execution timed out.",
+		},
+	}
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		for _, tt := range tests {
+			t.Run(backend.String()+"/"+tt.name, func(t *testing.T) {
+				lox := New(append(tt.opts, WithBackend(backend))...)
+				_, err := lox.Eval(context.Background(), tt.src)
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Eval() error = %v, want = %v", err, tt.want)
+				}
+				if tt.wantErr != "" && err.Error() != tt.wantErr {
+					t.Errorf("Eval() error = %q, wantErr = %q", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		stdout  string
+		wantErr string
+	}{
+		{
+			name: "stack overflow",
+			src:  "func f() { f(); }\nf();",
+			wantErr: "1:14: error: Stack overflow.\n" +
+				"\tin f() at 1:14\n" +
+				"\tin f() at 1:12\n" +
+				"\tin f() at 1:12\n" +
+				"\tin f() at 1:12\n" +
+				"\t... previous frame repeated 2 more times\n" +
+				"\tin script at 2:1",
+		},
+		{
+			name:   "caught",
+			src:    "func f() { f(); }\ntry { f(); } catch (e) { print e.message; }",
+			stdout: "Stack overflow.",
+		},
+		{
+			name: "error discarded by finally",
+			src: "func g() { nil(); }\nfunc f() { try { g(); } finally { return 1; } }\n" +
+				"for (var i = 0; i < 10; i = i + 1) f();\n" +
+				"func r(n) { if (n > 1) return r(n - 1); return n; }\nprint r(5);",
+			stdout: "1",
+		},
+		{
+			name:   "within limit",
+			src:    "func f(n) { if (n > 1) return f(n - 1); return n; }\nprint f(5);",
+			stdout: "1",
+		},
+	}
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		for _, tt := range tests {
+			t.Run(backend.String()+"/"+tt.name, func(t *testing.T) {
+				stdout := &bytes.Buffer{}
+				lox := New(WithStdout(stdout), WithMaxDepth(6), WithBackend(backend))
+				_, err := lox.Eval(context.Background(), tt.src)
+				if err != nil {
+					if err.Error() != tt.wantErr {
+						t.Errorf("Eval() error = %q, wantErr = %q", err, tt.wantErr)
+					}
+				} else if tt.wantErr != "" {
+					t.Errorf("Eval() error = nil, wantErr = %q", tt.wantErr)
+				}
+				if stdout.String() != tt.stdout {
+					t.Errorf("Eval() stdout = %q, want = %q", stdout, tt.stdout)
+				}
+			})
+		}
+	}
+}
+
+func TestAllocated(t *testing.T) {
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		t.Run(backend.String(), func(t *testing.T) {
+			lox := New(WithBackend(backend))
+			src := "var s = \"x\";\nfor (var i = 0; i < 10; i = i + 1) s = s + s;"
+			if _, err := lox.Eval(context.Background(), src); err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			// the strings built are 2, 4, ..., 1024 bytes long.
+			if got := lox.Allocated(); got < 2046 {
+				t.Errorf("Allocated() = %d, want at least 2046", got)
+			}
+		})
+	}
+}
+
+// TestAllocatedByBackend expects every backend to charge the same for a
+// script, and nothing for a loop that holds no memory.
+func TestAllocatedByBackend(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want int
+	}{
+		{
+			name: "loop",
+			src:  "var n = 0;\nfor (var i = 0; i < 200000; i = i + 1) { var j = i; n = n + 1; }",
+			want: 16,
+		},
+		{
+			name: "calls",
+			src:  "func f(n) { { var m = n; return m; } }\nfor (var i = 0; i < 200000; i = i + 1) f(i);",
+			want: 64 + 16,
+		},
+		{
+			name: "values",
+			src: `
+var s = "a" + 1;
+func f(n) { var local = n; return func () => local; }
+var g = f(1);
+class A { init() { this.x = 1; } }
+var a = A();
+a.y = 2;
+var l = [1, 2];
+push(l, 3);
+var m = {"a": 1};
+m["b"] = 2;`,
+			// every line charges its global, on top of the string, function,
+			// closure, class, instance and fields, list and map it creates.
+			want: (2 + 16) + (64 + 16) + (64 + 16) + (2*64 + 16) + (64 + 16 + 2*2*16) +
+				(64 + 2*16 + 16 + 16) + (64 + 2*16 + 16 + 2*16),
+		},
+	}
+	for _, tt := range tests {
+		for _, backend := range []Backend{TreeWalker, Closure, VM} {
+			t.Run(tt.name+"/"+backend.String(), func(t *testing.T) {
+				lox := New(WithBackend(backend), WithMemoryLimit(4<<20))
+				if _, err := lox.Eval(context.Background(), tt.src); err != nil {
+					t.Fatalf("Eval() error = %v", err)
+				}
+				if got := lox.Allocated(); got != tt.want {
+					t.Errorf("Allocated() = %d, want = %d", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestEvalCanceledWhileRunning(t *testing.T) {
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		t.Run(backend.String(), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			lox := New(WithBackend(backend))
+			lox.DefineNative("cancel", 0, func(...any) (any, error) {
+				cancel()
+				return nil, nil
+			})
+			_, err := lox.Eval(ctx, "func f() {}\ncancel();\nf();")
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Eval() error = %v, want = %v", err, context.Canceled)
+			}
+			if want := "3:3: error: Execution canceled."; err.Error() != want {
+				t.Errorf("Eval() error = %q, wantErr = %q", err, want)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir, shared := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(dir, "lib", "util.l"): `
+import "counter.l" as counter;
+export func twice(x) { return counter.bump() + x * 2; }
+export var name = "util";
+var hidden = 1;`,
+		filepath.Join(dir, "lib", "counter.l"): `
+var n = 0;
+export func bump() { n = n + 1; return n - 1; }`,
+		filepath.Join(dir, "a.l"):        `import "b.l" as b;`,
+		filepath.Join(dir, "b.l"):        `import "a.l" as a;`,
+		filepath.Join(dir, "broken.l"):   "var x = ;",
+		filepath.Join(shared, "greet.l"): `export func greet(n) { return "hi " + n; }`,
+	}
+	for file, src := range files {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		src     string
+		want    Value
+		wantErr string
+	}{
+		{
+			name: "exports",
+			src:  `import "lib/util.l" as u; u.twice(3) + u.twice(3);`,
+			want: float64(13),
+		},
+		{
+			name: "evaluated once",
+			src:  `import "lib/util.l" as u; import "lib/util.l" as again; u.name == again.name and typeof(u) == "module";`,
+			want: true,
+		},
+		{
+			name: "search path",
+			src:  `import "greet.l" as g; g.greet("lox");`,
+			want: "hi lox",
+		},
+		{
+			name:    "unexported",
+			src:     `import "lib/util.l" as u; u.hidden;`,
+			wantErr: `1:29: error: Module "lib/util.l" has no export 'hidden'.`,
+		},
+		{
+			name:    "cycle",
+			src:     `import "a.l" as a;`,
+			wantErr: "1:8: error: Can't import \"a.l\".\n\t" + filepath.Join(dir, "a.l") + ":1:8: Can't import \"b.l\".\n\t" + filepath.Join(dir, "b.l") + ":1:8: Import cycle: a.l -> b.l -> a.l.",
+		},
+		{
+			name:    "syntax error",
+			src:     `import "broken.l" as b;`,
+			wantErr: "1:8: error: Can't import \"broken.l\".\n\t" + filepath.Join(dir, "broken.l") + ":1:9: Expect expression.",
+		},
+		{
+			name:    "missing",
+			src:     `import "missing.l" as m;`,
+			wantErr: "1:8: error: Can't import \"missing.l\".\n\tModule not found in " + dir + ", " + shared + ".",
+		},
+		{
+			name:    "nested",
+			src:     `{ import "a.l" as a; }`,
+			wantErr: "1:3: error: Can only import at the top level.",
+		},
+	}
+	for _, backend := range []Backend{TreeWalker, Closure, VM} {
+		for _, tt := range tests {
+			t.Run(backend.String()+"/"+tt.name, func(t *testing.T) {
+				lox := New(WithStdout(io.Discard), WithPath(shared), WithBackend(backend))
+				// the main script imports relative to its own file.
+				got, err := lox.eval(context.Background(), filepath.Join(dir, "main.l"), []byte(tt.src))
+				if err != nil {
+					if err.Error() != tt.wantErr {
+						t.Errorf("Eval() error = %q, wantErr = %q", err, tt.wantErr)
+					}
+					return
+				}
+				if tt.wantErr != "" {
+					t.Fatalf("Eval() error = nil, wantErr = %q", tt.wantErr)
+				}
+				if got != tt.want {
+					t.Errorf("Eval() got = %v, want = %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+// TestBackends runs the scripts under testcase with every backend and
+// expects the same output and errors.
+func TestBackends(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "testcase", "*.l"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			want := &bytes.Buffer{}
+			_, wantErr := New(WithStdout(want)).EvalFile(context.Background(), file)
+			for _, backend := range []Backend{Closure, VM} {
+				got := &bytes.Buffer{}
+				_, gotErr := New(WithStdout(got), WithBackend(backend)).EvalFile(context.Background(), file)
+				if got.String() != want.String() {
+					t.Errorf("%v stdout = %q, tree walker stdout = %q", backend, got, want)
+				}
+				if fmt.Sprint(gotErr) != fmt.Sprint(wantErr) {
+					t.Errorf("%v error = %v, tree walker error = %v", backend, gotErr, wantErr)
+				}
+			}
+		})
+	}
+}
+
+// TestEvalByBackend expects every backend to print and return the same
+// for scripts whose semantics the backends implement separately.
+func TestEvalByBackend(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		want   Value
+	}{
+		{
+			name:   "local function shadows from its declaration",
+			src:    "func g() { return 1; }\n{ print g(); func g() { return 2; } print g(); }",
+			stdout: "12",
+		},
+		{
+			name: "mutually recursive local functions",
+			src: `{
+  func isEven(n) { if (n == 0) return true; return isOdd(n - 1); }
+  func isOdd(n) { if (n == 0) return false; return isEven(n - 1); }
+  print isEven(4);
+}`,
+			stdout: "true",
+		},
+		{
+			name: "local function called before its declaration",
+			src: `func g() { return "outer"; }
+{
+  func f() { return g(); }
+  print f();
+  func g() { return "inner"; }
+  print f();
+}`,
+			stdout: "outerinner",
+		},
+		{
+			name: "bound methods",
+			src: `class A { m() {} }
+var p = A();
+var q = A();
+print p.m == p.m;
+print p.m == q.m;`,
+			stdout: "truefalse",
+		},
+		{
+			name:   "closures",
+			src:    "func mk() { func f() {} return f; }\nvar f = mk();\nprint f == f;\nprint mk() == mk();",
+			stdout: "truefalse",
+		},
+		{
+			name: "value of an expression statement",
+			src:  "1 + 1;",
+			want: float64(2),
+		},
+		{
+			name: "value of an if statement",
+			src:  "if (true) 1 + 1;",
+		},
+	}
+	for _, tt := range tests {
+		for _, backend := range []Backend{TreeWalker, Closure, VM} {
+			t.Run(tt.name+"/"+backend.String(), func(t *testing.T) {
+				stdout := &bytes.Buffer{}
+				lox := New(WithBackend(backend), WithStdout(stdout))
+				got, err := lox.Eval(context.Background(), tt.src)
+				if err != nil {
+					t.Fatalf("Eval() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("Eval() got = %v, want = %v", got, tt.want)
+				}
+				if stdout.String() != tt.stdout {
+					t.Errorf("Eval() stdout = %q, want = %q", stdout.String(), tt.stdout)
+				}
+			})
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.l")
+	if err := os.WriteFile(file, []byte("func f() { return 1; }\nprint f();"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdout := &bytes.Buffer{}
+	if err := New(WithStdout(stdout)).Disassemble(file); err != nil {
+		t.Fatalf("Disassemble() error = %v", err)
+	}
+	for _, want := range []string{"== <script> ==", "CALL", "== <fn f> ==", "RETURN"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Disassemble() output %q does not contain %q", stdout, want)
+		}
+	}
+}
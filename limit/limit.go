@@ -0,0 +1,101 @@
+// Package limit bounds the work scripts do, so that hosts can stop the
+// ones that run for too long.
+package limit
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBudgetExceeded is the cause of the error that stops a script once it
+// has used up its execution budget.
+var ErrBudgetExceeded = errors.New("execution budget exceeded")
+
+// ErrMemoryExceeded is the cause of the error that stops a script once it
+// has allocated more memory than it may.
+var ErrMemoryExceeded = errors.New("memory limit exceeded")
+
+// Sizes, in bytes, that engines charge for what scripts allocate. They
+// approximate the memory used on 64-bit platforms; strings are charged
+// their length on top. Engines only charge for values that can outlive the
+// statement creating them, so that scopes and calls, which go away when
+// they end, do not count, and every engine charges the same for a script.
+const (
+	// SlotSize is the size of a global variable, element, field or map
+	// entry half, which holds any value.
+	SlotSize = 16
+	// ObjectSize is the overhead of a collection, instance, class or
+	// function, including the variables the function captures.
+	ObjectSize = 64
+)
+
+// DefaultMaxDepth is the number of calls that can be nested unless
+// configured otherwise. Deeper recursion fails with a "Stack overflow."
+// runtime error rather than exhausting the Go stack.
+const DefaultMaxDepth = 10000
+
+// Meter counts the steps of a run, the loop iterations and calls it makes,
+// and the bytes it allocates, and tells when the run must stop.
+type Meter struct {
+	ctx  context.Context
+	done <-chan struct{}
+	// budget is the number of steps allowed, or zero for no limit.
+	budget int
+	steps  int
+	// memory is the number of bytes that can be allocated, or zero for no
+	// limit.
+	memory    int
+	allocated int
+}
+
+// NewMeter returns a meter allowing budget steps and memory bytes, or any
+// number of them when zero, for as long as ctx is not done.
+func NewMeter(ctx context.Context, budget, memory int) Meter {
+	return Meter{ctx: ctx, done: ctx.Done(), budget: budget, memory: memory}
+}
+
+// Step records a step and returns why the run must stop, if it must:
+// ErrBudgetExceeded or the error of the context.
+func (m *Meter) Step() error {
+	m.steps++
+	if m.budget > 0 && m.steps > m.budget {
+		return ErrBudgetExceeded
+	}
+	if m.done != nil {
+		select {
+		case <-m.done:
+			return m.ctx.Err()
+		default:
+		}
+	}
+	return nil
+}
+
+// Alloc records size bytes allocated, and returns ErrMemoryExceeded once
+// the run has allocated more than it may. Memory is never given back: the
+// limit bounds what a run allocates, not what it holds at once.
+func (m *Meter) Alloc(size int) error {
+	m.allocated += size
+	if m.memory > 0 && m.allocated > m.memory {
+		return ErrMemoryExceeded
+	}
+	return nil
+}
+
+// Allocated returns the number of bytes recorded by Alloc.
+func (m *Meter) Allocated() int {
+	return m.allocated
+}
+
+// Message describes err, returned by Step, as a runtime error message.
+func Message(err error) string {
+	switch {
+	case errors.Is(err, ErrBudgetExceeded):
+		return "Execution budget exceeded."
+	case errors.Is(err, ErrMemoryExceeded):
+		return "Memory limit exceeded."
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Execution timed out."
+	}
+	return "Execution canceled."
+}
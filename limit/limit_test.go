@@ -0,0 +1,68 @@
+package limit
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMeter(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		budget int
+		steps  int
+		want   error
+	}{
+		{name: "unlimited", ctx: context.Background(), steps: 1000},
+		{name: "within budget", ctx: context.Background(), budget: 3, steps: 3},
+		{name: "over budget", ctx: context.Background(), budget: 3, steps: 4, want: ErrBudgetExceeded},
+		{name: "canceled", ctx: canceled, steps: 1, want: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMeter(tt.ctx, tt.budget, 0)
+			var err error
+			for n := 0; n < tt.steps && err == nil; n++ {
+				err = m.Step()
+			}
+			if err != tt.want {
+				t.Errorf("Step() error = %v, want = %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlloc(t *testing.T) {
+	m := NewMeter(context.Background(), 0, 100)
+	if err := m.Alloc(60); err != nil {
+		t.Fatalf("Alloc(60) error = %v", err)
+	}
+	if err := m.Alloc(40); err != nil {
+		t.Fatalf("Alloc(40) error = %v", err)
+	}
+	if err := m.Alloc(1); err != ErrMemoryExceeded {
+		t.Errorf("Alloc(1) error = %v, want = %v", err, ErrMemoryExceeded)
+	}
+	if got := m.Allocated(); got != 101 {
+		t.Errorf("Allocated() = %d, want = 101", got)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: ErrBudgetExceeded, want: "Execution budget exceeded."},
+		{err: ErrMemoryExceeded, want: "Memory limit exceeded."},
+		{err: context.DeadlineExceeded, want: "Execution timed out."},
+		{err: context.Canceled, want: "Execution canceled."},
+	}
+	for _, tt := range tests {
+		if got := Message(tt.err); got != tt.want {
+			t.Errorf("Message(%v) = %q, want = %q", tt.err, got, tt.want)
+		}
+	}
+}
@@ -1,93 +1,72 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"io"
 	"os"
-	"strings"
+	"path/filepath"
 
-	"github.com/cndoit18/lox/evaluator"
-	"github.com/cndoit18/lox/parser"
-	"github.com/cndoit18/lox/scanner"
+	"github.com/cndoit18/lox/interpreter"
 )
 
-func main() {
-	if len(os.Args) > 2 {
-		fmt.Println("Usage: lox [script]")
-		os.Exit(64)
-	} else if len(os.Args) == 2 {
-		if err := runFile(os.Args[1]); err != nil {
-			panic(err)
-		}
-	} else {
-		if err := runPrompt(); err != nil {
-			panic(err)
-		}
-	}
-}
-
-func runFile(path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+var backend = flag.String("backend", "tree", "execute programs with the tree walker (tree), compiled closures (closure) or the bytecode VM (vm)")
 
-	return run(f)
+func usage() {
+	fmt.Println("Usage: lox [-backend=tree|closure|vm] [script]")
+	fmt.Println("       lox disasm script")
+	os.Exit(64)
 }
 
-func run(r io.Reader) error {
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(error); ok {
-				fmt.Fprintln(os.Stderr, r)
-				os.Exit(1)
-			}
-		}
-	}()
-	scan, err := scanner.NewScanner(r)
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	opts, err := options()
 	if err != nil {
-		return err
+		fmt.Println(err)
+		usage()
 	}
 
-	tokens := scan.ScanTokens()
-	if err := scan.Err(); err != nil {
-		return err
+	if flag.Arg(0) == "disasm" {
+		if flag.NArg() != 2 {
+			usage()
+		}
+		lox := interpreter.New(opts...)
+		if err := lox.Disassemble(flag.Arg(1)); err != nil {
+			lox.Report(err)
+			os.Exit(1)
+		}
+	} else if flag.NArg() > 1 {
+		usage()
+	} else if flag.NArg() == 1 {
+		lox := interpreter.New(opts...)
+		if err := runFile(lox, flag.Arg(0)); err != nil {
+			lox.Report(err)
+			os.Exit(1)
+		}
+	} else {
+		if err := runPrompt(opts...); err != nil {
+			panic(err)
+		}
 	}
+}
 
-	parse := parser.NewParser[any](tokens...)
-	stmts, err := parse.Parse()
+// options configures interpreters from the command line, and adds the
+// directories listed in $LOX_PATH to the module search path.
+func options() ([]interpreter.Option, error) {
+	b, err := interpreter.ParseBackend(*backend)
 	if err != nil {
-		return err
-	}
-	evaluator := evaluator.New()
-	interpreter := evaluator.Interpreter()
-	for _, stmt := range stmts {
-		stmt.Accept(evaluator)
+		return nil, err
 	}
-	for _, stmt := range stmts {
-		stmt.Accept(interpreter)
-	}
-	return nil
+	return []interpreter.Option{
+		interpreter.WithBackend(b),
+		interpreter.WithPath(filepath.SplitList(os.Getenv("LOX_PATH"))...),
+	}, nil
 }
 
-func runPrompt() error {
-	scan := bufio.NewScanner(os.Stdin)
-
-	fmt.Printf("> ")
-	for scan.Scan() {
-		run(strings.NewReader(scan.Text()))
-		fmt.Printf("> ")
-	}
-
-	if err := scan.Err(); err != nil {
-		if err == io.EOF {
-			return nil
-		}
-		return err
-	}
-	return nil
+func runFile(lox *interpreter.Interpreter, path string) error {
+	_, err := lox.EvalFile(context.Background(), path)
+	return err
 }
 
 type lineError struct {
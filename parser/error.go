@@ -1,8 +1,7 @@
 package parser
 
 import (
-	"fmt"
-
+	"github.com/cndoit18/lox/diagnostic"
 	"github.com/cndoit18/lox/token"
 )
 
@@ -12,7 +11,20 @@ type parseError struct {
 }
 
 func (p *parseError) Error() string {
-	return fmt.Sprintf("%s\n[line: %d]", p.msg, p.token.Line)
+	return p.Diagnostic().String()
+}
+
+func (p *parseError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     p.token.Span(),
+		Message:  p.msg,
+	}
+}
+
+// Token returns the token the error was reported at.
+func (p *parseError) Token() token.Token {
+	return p.token
 }
 
 func newParseError(token token.Token, msg string) error {
@@ -10,6 +10,7 @@ import (
 type parser[T any] struct {
 	tokens  []token.Token
 	current int
+	errs    []error
 }
 
 func NewParser[T any](tokens ...token.Token) *parser[T] {
@@ -19,22 +20,62 @@ func NewParser[T any](tokens ...token.Token) *parser[T] {
 }
 
 // program        → declaration* EOF ;
+//
+// Parse keeps going after a syntax error, so the returned error joins every
+// error found in tokens. The statements that did parse are returned as well.
 func (p *parser[T]) Parse() ([]ast.Stmt[T], error) {
 	program := []ast.Stmt[T]{}
 	for p.hasNext() {
 		stmt, err := p.declaration()
 		if err != nil {
-			return nil, err
+			p.report(err)
+			continue
 		}
 		program = append(program, stmt)
 	}
-	return program, nil
+	return program, errors.Join(p.errs...)
+}
+
+// report records err and discards tokens up to the start of the next
+// statement, so parsing can resume there.
+func (p *parser[T]) report(err error) {
+	p.errs = append(p.errs, err)
+	p.synchronize()
+}
+
+func (p *parser[T]) synchronize() {
+	p.advance()
+	for p.hasNext() {
+		if p.previous().Type == token.SEMICOLON {
+			return
+		}
+		switch p.peek().Type {
+		case token.CLASS, token.FUN, token.VAR, token.FOR,
+			token.IF, token.WHILE, token.PRINT, token.RETURN,
+			token.THROW, token.TRY, token.IMPORT, token.EXPORT,
+			token.BREAK, token.CONTINUE:
+			return
+		}
+		p.advance()
+	}
 }
 
-// declaration    → function | varDecl | statement ;
+// declaration    → importDecl | exportDecl | classDecl | function | varDecl | statement ;
 func (p *parser[T]) declaration() (ast.Stmt[T], error) {
-	if p.match(token.FUN) {
-		return p.function()
+	if p.match(token.IMPORT) {
+		return p.importDecl()
+	}
+	if p.match(token.EXPORT) {
+		return p.exportDecl()
+	}
+	if p.match(token.CLASS) {
+		return p.classDecl()
+	}
+	// "func" followed by a name declares a function; otherwise it starts
+	// an anonymous function expression.
+	if p.check(token.FUN) && p.checkAt(1, token.IDENTIFIER) {
+		p.advance()
+		return p.function("function")
 	}
 	if p.match(token.VAR) {
 		return p.varDecl()
@@ -42,14 +83,123 @@ func (p *parser[T]) declaration() (ast.Stmt[T], error) {
 	return p.statement()
 }
 
-func (p *parser[T]) function() (ast.Stmt[T], error) {
-	if err := p.consume(token.IDENTIFIER, "Expect function name."); err != nil {
+// importDecl     → "import" STRING "as" IDENTIFIER ";" ;
+func (p *parser[T]) importDecl() (ast.Stmt[T], error) {
+	stmt := &ast.StmtImport[T]{
+		Keyword: p.previous(),
+	}
+	if err := p.consume(token.STRING, "Expect module path after 'import'."); err != nil {
+		return nil, err
+	}
+	stmt.Path = p.previous()
+	if err := p.consume(token.AS, "Expect 'as' after module path."); err != nil {
+		return nil, err
+	}
+	if err := p.consume(token.IDENTIFIER, "Expect module name after 'as'."); err != nil {
+		return nil, err
+	}
+	stmt.Name = p.previous()
+	if err := p.consume(token.SEMICOLON, "Expect ';' after import."); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// exportDecl     → "export" ( classDecl | function | varDecl ) ;
+func (p *parser[T]) exportDecl() (ast.Stmt[T], error) {
+	keyword := p.previous()
+	var (
+		declaration ast.Stmt[T]
+		err         error
+	)
+	switch {
+	case p.match(token.CLASS):
+		declaration, err = p.classDecl()
+	case p.check(token.FUN) && p.checkAt(1, token.IDENTIFIER):
+		p.advance()
+		declaration, err = p.function("function")
+	case p.match(token.VAR):
+		declaration, err = p.varDecl()
+	default:
+		return nil, newParseError(p.peek(), "Expect declaration after 'export'.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ast.StmtExport[T]{
+		Keyword:     keyword,
+		Declaration: declaration,
+	}, nil
+}
+
+// classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
+func (p *parser[T]) classDecl() (ast.Stmt[T], error) {
+	if err := p.consume(token.IDENTIFIER, "Expect class name."); err != nil {
+		return nil, err
+	}
+	name := p.previous()
+
+	var superclass *ast.ExprVariable[T]
+	if p.match(token.LESS) {
+		if err := p.consume(token.IDENTIFIER, "Expect superclass name."); err != nil {
+			return nil, err
+		}
+		superclass = &ast.ExprVariable[T]{
+			Name: p.previous(),
+		}
+	}
+	if err := p.consume(token.LEFT_BRACE, "Expect '{' before class body."); err != nil {
+		return nil, err
+	}
+
+	methods := []*ast.StmtFunction[T]{}
+	for !p.check(token.RIGHT_BRACE) && p.hasNext() {
+		method, err := p.function("method")
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+
+	if err := p.consume(token.RIGHT_BRACE, "Expect '}' after class body."); err != nil {
+		return nil, err
+	}
+	return &ast.StmtClass[T]{
+		Name:       name,
+		Superclass: superclass,
+		Methods:    methods,
+	}, nil
+}
+
+// function       → IDENTIFIER "(" parameters? ")" block ;
+func (p *parser[T]) function(kind string) (*ast.StmtFunction[T], error) {
+	if err := p.consume(token.IDENTIFIER, "Expect "+kind+" name."); err != nil {
 		return nil, err
 	}
 	name := p.previous()
-	if err := p.consume(token.LEFT_PAREN, "Expect '(' after function name."); err != nil {
+	if err := p.consume(token.LEFT_PAREN, "Expect '(' after "+kind+" name."); err != nil {
 		return nil, err
 	}
+	parameters, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(token.LEFT_BRACE, "Expect '{}' befor function body."); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.StmtFunction[T]{
+		Name:   name,
+		Params: parameters,
+		Body:   body,
+	}, nil
+}
+
+// parameters     → ( IDENTIFIER ( "," IDENTIFIER )* )? ")" ;
+func (p *parser[T]) parameters() ([]token.Token, error) {
 	parameters := []token.Token{}
 	if !p.check(token.RIGHT_PAREN) {
 		for {
@@ -71,18 +221,43 @@ func (p *parser[T]) function() (ast.Stmt[T], error) {
 	if err := p.consume(token.RIGHT_PAREN, "Expect ')' after parameters."); err != nil {
 		return nil, err
 	}
-	if err := p.consume(token.LEFT_BRACE, "Expect '{}' befor function body."); err != nil {
+	return parameters, nil
+}
+
+// lambda         → "func" "(" parameters ( block | "=>" expression ) ;
+func (p *parser[T]) lambda() (ast.Expr[T], error) {
+	keyword := p.previous()
+	if err := p.consume(token.LEFT_PAREN, "Expect '(' after 'func'."); err != nil {
 		return nil, err
 	}
-	body, err := p.block()
+	parameters, err := p.parameters()
 	if err != nil {
 		return nil, err
 	}
-	return &ast.StmtFunction[T]{
-		Name:   name,
-		Params: parameters,
-		Body:   body,
-	}, nil
+	expr := &ast.ExprFunction[T]{
+		Keyword: keyword,
+		Params:  parameters,
+	}
+	if p.match(token.ARROW) {
+		arrow := p.previous()
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		expr.Body = &ast.StmtBlock[T]{
+			Lbrace:     arrow,
+			Statements: []ast.Stmt[T]{&ast.StmtReturn[T]{Keyword: arrow, Value: value}},
+			Rbrace:     p.previous(),
+		}
+		return expr, nil
+	}
+	if err := p.consume(token.LEFT_BRACE, "Expect '{' or '=>' before function body."); err != nil {
+		return nil, err
+	}
+	if expr.Body, err = p.block(); err != nil {
+		return nil, err
+	}
+	return expr, nil
 }
 
 // varDecl        → "var" IDENTIFIER ( "=" expression )? ";" ;
@@ -106,12 +281,36 @@ func (p *parser[T]) varDecl() (ast.Stmt[T], error) {
 	return nil, newParseError(p.peek(), "Expect IDENTIFIER after value.")
 }
 
-// statement      → exprStmt | ifStmt | printStmt | returnStmt | whileStmt | forStmt | block ;
+// statement      → exprStmt | ifStmt | printStmt | returnStmt | whileStmt | forStmt | throwStmt | tryStmt | breakStmt | continueStmt | block ;
 func (p *parser[T]) statement() (ast.Stmt[T], error) {
 	if p.match(token.PRINT) {
 		return p.printStmt()
 	}
 
+	if p.match(token.BREAK) {
+		keyword := p.previous()
+		if err := p.consume(token.SEMICOLON, "Expect ';' after 'break'."); err != nil {
+			return nil, err
+		}
+		return &ast.StmtBreak[T]{Keyword: keyword}, nil
+	}
+
+	if p.match(token.CONTINUE) {
+		keyword := p.previous()
+		if err := p.consume(token.SEMICOLON, "Expect ';' after 'continue'."); err != nil {
+			return nil, err
+		}
+		return &ast.StmtContinue[T]{Keyword: keyword}, nil
+	}
+
+	if p.match(token.THROW) {
+		return p.throwStmt()
+	}
+
+	if p.match(token.TRY) {
+		return p.tryStmt()
+	}
+
 	if p.match(token.RETURN) {
 		return p.returnStmt()
 	}
@@ -134,6 +333,70 @@ func (p *parser[T]) statement() (ast.Stmt[T], error) {
 	return p.exprStmt()
 }
 
+// throwStmt      → "throw" expression ";" ;
+func (p *parser[T]) throwStmt() (ast.Stmt[T], error) {
+	keyword := p.previous()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(token.SEMICOLON, "Expect ';' after thrown value."); err != nil {
+		return nil, err
+	}
+	return &ast.StmtThrow[T]{
+		Keyword: keyword,
+		Value:   value,
+	}, nil
+}
+
+// tryStmt        → "try" block ( "catch" "(" IDENTIFIER ")" block )? ( "finally" block )? ;
+func (p *parser[T]) tryStmt() (ast.Stmt[T], error) {
+	stmt := &ast.StmtTry[T]{
+		Keyword: p.previous(),
+	}
+	if err := p.consume(token.LEFT_BRACE, "Expect '{' after 'try'."); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Body = body
+
+	if p.match(token.CATCH) {
+		if err := p.consume(token.LEFT_PAREN, "Expect '(' after 'catch'."); err != nil {
+			return nil, err
+		}
+		if err := p.consume(token.IDENTIFIER, "Expect exception name."); err != nil {
+			return nil, err
+		}
+		stmt.Name = p.previous()
+		if err := p.consume(token.RIGHT_PAREN, "Expect ')' after exception name."); err != nil {
+			return nil, err
+		}
+		if err := p.consume(token.LEFT_BRACE, "Expect '{' before catch body."); err != nil {
+			return nil, err
+		}
+		if stmt.Catch, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.match(token.FINALLY) {
+		if err := p.consume(token.LEFT_BRACE, "Expect '{' after 'finally'."); err != nil {
+			return nil, err
+		}
+		if stmt.Finally, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.Catch == nil && stmt.Finally == nil {
+		return nil, newParseError(p.peek(), "Expect 'catch' or 'finally' after try block.")
+	}
+	return stmt, nil
+}
+
 func (p *parser[T]) returnStmt() (ast.Stmt[T], error) {
 	keyword := p.previous()
 	var (
@@ -158,6 +421,7 @@ func (p *parser[T]) returnStmt() (ast.Stmt[T], error) {
 
 // whileStmt      → "while" "(" expression ")" statement ;
 func (p *parser[T]) whileStmt() (ast.Stmt[T], error) {
+	keyword := p.previous()
 	if err := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'."); err != nil {
 		return nil, err
 	}
@@ -173,16 +437,21 @@ func (p *parser[T]) whileStmt() (ast.Stmt[T], error) {
 		return nil, err
 	}
 	return &ast.StmtWhile[T]{
+		Keyword:   keyword,
 		Condition: condition,
 		Body:      stmt,
 	}, nil
 }
 
-// forStmt        → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+// forStmt        → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement | forInStmt ;
 func (p *parser[T]) forStmt() (ast.Stmt[T], error) {
+	keyword := p.previous()
 	if err := p.consume(token.LEFT_PAREN, "Expect '(' after 'for'."); err != nil {
 		return nil, err
 	}
+	if p.check(token.VAR) && p.checkAt(1, token.IDENTIFIER) && p.checkAt(2, token.IN) {
+		return p.forInStmt(keyword)
+	}
 	var (
 		initializer ast.Stmt[T]
 		err         error
@@ -211,6 +480,9 @@ func (p *parser[T]) forStmt() (ast.Stmt[T], error) {
 	if err := p.consume(token.SEMICOLON, "Expect ';' after loop condition."); err != nil {
 		return nil, err
 	}
+	if condition == nil {
+		condition = &ast.ExprLiteral[T]{Token: p.previous(), Value: true}
+	}
 	var increment ast.Expr[T]
 	if !p.check(token.RIGHT_PAREN) {
 		increment, err = p.expression()
@@ -231,38 +503,59 @@ func (p *parser[T]) forStmt() (ast.Stmt[T], error) {
 		body = append(body, initializer)
 	}
 
-	if condition == nil {
-		condition = &ast.ExprLiteral[T]{Value: true}
-	}
-
-	whileStmts := []ast.Stmt[T]{statement}
-	if increment != nil {
-		whileStmts = append(whileStmts, &ast.StmtExpr[T]{Expression: increment})
-	}
-
+	// the increment lives on the loop rather than at the end of its body,
+	// so that continue does not skip it.
+	end := p.previous()
 	body = append(body, &ast.StmtWhile[T]{
+		Keyword:   keyword,
 		Condition: condition,
-		Body: &ast.StmtBlock[T]{
-			Statements: whileStmts,
-		},
+		Body:      statement,
+		Increment: increment,
 	})
 
 	// {
 	// 	var i = 0;
-	// 	while (i < 10) {
+	// 	while (i < 10; i = i + 1) {
 	// 	  print i;
-	// 	  i = i + 1;
 	// 	}
 	// }
 
 	return &ast.StmtBlock[T]{
+		Lbrace:     keyword,
 		Statements: body,
+		Rbrace:     end,
+	}, nil
+}
+
+// forInStmt      → "for" "(" "var" IDENTIFIER "in" expression ")" statement ;
+func (p *parser[T]) forInStmt(keyword token.Token) (ast.Stmt[T], error) {
+	// "var" IDENTIFIER "in" has already been checked.
+	p.advance()
+	name := p.advance()
+	p.advance()
+	iterable, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.consume(token.RIGHT_PAREN, "Expect ')' after for clauses."); err != nil {
+		return nil, err
+	}
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.StmtForIn[T]{
+		Keyword:  keyword,
+		Name:     name,
+		Iterable: iterable,
+		Body:     body,
 	}, nil
 }
 
 // ifStmt         → "if" "(" expression ")" statement
 // ( "else" statement )? ;
 func (p *parser[T]) ifStmt() (ast.Stmt[T], error) {
+	keyword := p.previous()
 	if err := p.consume(token.LEFT_PAREN, "Expect '(' after 'if'."); err != nil {
 		return nil, err
 	}
@@ -285,18 +578,21 @@ func (p *parser[T]) ifStmt() (ast.Stmt[T], error) {
 		}
 	}
 	return &ast.StmtIf[T]{
+		Keyword:    keyword,
 		Condition:  condition,
 		ThenBranch: thenBranch,
 		ElseBranch: elseBranch,
 	}, nil
 }
 
-func (p *parser[T]) block() (ast.Stmt[T], error) {
+func (p *parser[T]) block() (*ast.StmtBlock[T], error) {
+	lbrace := p.previous()
 	statements := []ast.Stmt[T]{}
 	for !p.check(token.RIGHT_BRACE) && p.hasNext() {
 		stmt, err := p.declaration()
 		if err != nil {
-			return nil, err
+			p.report(err)
+			continue
 		}
 		statements = append(statements, stmt)
 	}
@@ -304,12 +600,15 @@ func (p *parser[T]) block() (ast.Stmt[T], error) {
 		return nil, err
 	}
 	return &ast.StmtBlock[T]{
+		Lbrace:     lbrace,
 		Statements: statements,
+		Rbrace:     p.previous(),
 	}, nil
 }
 
 // print      → "print" expression ";" ;
 func (p *parser[T]) printStmt() (ast.Stmt[T], error) {
+	keyword := p.previous()
 	expr, err := p.expression()
 	if err != nil {
 		return nil, err
@@ -318,6 +617,7 @@ func (p *parser[T]) printStmt() (ast.Stmt[T], error) {
 		return nil, err
 	}
 	return &ast.StmtPrint[T]{
+		Keyword:    keyword,
 		Expression: expr,
 	}, nil
 }
@@ -384,7 +684,7 @@ func (p *parser[T]) logicAnd() (ast.Expr[T], error) {
 	return expr, nil
 }
 
-// assignment     → IDENTIFIER "=" assignment | logicOr ;
+// assignment     → ( call "." )? IDENTIFIER "=" assignment | call "[" expression "]" "=" assignment | logicOr ;
 func (p *parser[T]) assignment() (ast.Expr[T], error) {
 	expr, err := p.logicOr()
 	if err != nil {
@@ -402,7 +702,23 @@ func (p *parser[T]) assignment() (ast.Expr[T], error) {
 				Value: value,
 			}, nil
 		}
-		panic(newParseError(equals, "Invalid assignment target."))
+		if e, ok := expr.(*ast.ExprGet[T]); ok {
+			return &ast.ExprSet[T]{
+				Object: e.Object,
+				Name:   e.Name,
+				Value:  value,
+			}, nil
+		}
+		if e, ok := expr.(*ast.ExprIndex[T]); ok {
+			return &ast.ExprIndexSet[T]{
+				Object:   e.Object,
+				Index:    e.Index,
+				Rbracket: e.Rbracket,
+				Value:    value,
+			}, nil
+		}
+		// the target is reported, but there is no need to synchronize.
+		p.errs = append(p.errs, newParseError(equals, "Invalid assignment target."))
 	}
 	return expr, nil
 }
@@ -507,7 +823,7 @@ func (p *parser[T]) unary() (ast.Expr[T], error) {
 	return p.call()
 }
 
-// call           → primary ( "(" arguments? ")" )* ;
+// call           → primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" )* ;
 func (p *parser[T]) call() (ast.Expr[T], error) {
 	expr, err := p.primary()
 	if err != nil {
@@ -519,6 +835,27 @@ func (p *parser[T]) call() (ast.Expr[T], error) {
 			if err != nil {
 				return nil, err
 			}
+		} else if p.match(token.DOT) {
+			if err := p.consume(token.IDENTIFIER, "Expect property name after '.'."); err != nil {
+				return nil, err
+			}
+			expr = &ast.ExprGet[T]{
+				Object: expr,
+				Name:   p.previous(),
+			}
+		} else if p.match(token.LEFT_BRACKET) {
+			index, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.consume(token.RIGHT_BRACKET, "Expect ']' after index."); err != nil {
+				return nil, err
+			}
+			expr = &ast.ExprIndex[T]{
+				Object:   expr,
+				Index:    index,
+				Rbracket: p.previous(),
+			}
 		} else {
 			break
 		}
@@ -560,34 +897,64 @@ func (p *parser[T]) arguments() (ast.Expr[T], error) {
 	return nil, nil
 }
 
-// primary        → NUMBER | STRING | "true" | "false" | "nil"
-//                | "(" expression ")" | IDENTIFIER ;
+// primary        → NUMBER | STRING | "true" | "false" | "nil" | "this"
+//                | "(" expression ")" | IDENTIFIER | "super" "." IDENTIFIER
+//                | "[" ( expression ( "," expression )* ","? )? "]"
+//                | "{" ( entry ( "," entry )* ","? )? "}" | lambda ;
+// entry          → expression ":" expression ;
+//
+// A "{" that starts a statement always opens a block, so map literals are
+// only parsed where an expression is expected.
 
 func (p *parser[T]) primary() (ast.Expr[T], error) {
 	if p.match(token.FALSE) {
 		return &ast.ExprLiteral[T]{
+			Token: p.previous(),
 			Value: false,
 		}, nil
 	}
 
 	if p.match(token.TRUE) {
 		return &ast.ExprLiteral[T]{
+			Token: p.previous(),
 			Value: true,
 		}, nil
 	}
 
 	if p.match(token.NIL) {
 		return &ast.ExprLiteral[T]{
+			Token: p.previous(),
 			Value: nil,
 		}, nil
 	}
 
 	if p.match(token.STRING, token.NUMBER) {
 		return &ast.ExprLiteral[T]{
+			Token: p.previous(),
 			Value: p.previous().Literal,
 		}, nil
 	}
 
+	if p.match(token.SUPER) {
+		keyword := p.previous()
+		if err := p.consume(token.DOT, "Expect '.' after 'super'."); err != nil {
+			return nil, err
+		}
+		if err := p.consume(token.IDENTIFIER, "Expect superclass method name."); err != nil {
+			return nil, err
+		}
+		return &ast.ExprSuper[T]{
+			Keyword: keyword,
+			Method:  p.previous(),
+		}, nil
+	}
+
+	if p.match(token.THIS) {
+		return &ast.ExprThis[T]{
+			Keyword: p.previous(),
+		}, nil
+	}
+
 	if p.match(token.IDENTIFIER) {
 		return &ast.ExprVariable[T]{
 			Name: p.previous(),
@@ -595,18 +962,85 @@ func (p *parser[T]) primary() (ast.Expr[T], error) {
 	}
 
 	if p.match(token.LEFT_PAREN) {
+		lparen := p.previous()
 		expr, err := p.expression()
 		if err != nil {
 			return nil, err
 		}
 
-		if p.match(token.RIGHT_PAREN) {
-			return &ast.ExprGrouping[T]{
-				Expression: expr,
-			}, nil
+		if err := p.consume(token.RIGHT_PAREN, "Expect ')' after expression."); err != nil {
+			return nil, err
+		}
+		return &ast.ExprGrouping[T]{
+			Lparen:     lparen,
+			Expression: expr,
+			Rparen:     p.previous(),
+		}, nil
+	}
+	if p.match(token.LEFT_BRACKET) {
+		return p.list()
+	}
+
+	if p.match(token.LEFT_BRACE) {
+		return p.mapLiteral()
+	}
+
+	if p.match(token.FUN) {
+		return p.lambda()
+	}
+	return nil, newParseError(p.peek(), "Expect expression.")
+}
+
+func (p *parser[T]) mapLiteral() (ast.Expr[T], error) {
+	expr := &ast.ExprMap[T]{
+		Lbrace: p.previous(),
+	}
+	for !p.check(token.RIGHT_BRACE) {
+		key, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.consume(token.COLON, "Expect ':' after map key."); err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		expr.Keys = append(expr.Keys, key)
+		expr.Values = append(expr.Values, value)
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	if err := p.consume(token.RIGHT_BRACE, "Expect '}' after map entries."); err != nil {
+		return nil, err
+	}
+	expr.Rbrace = p.previous()
+	return expr, nil
+}
+
+func (p *parser[T]) list() (ast.Expr[T], error) {
+	lbracket := p.previous()
+	elements := []ast.Expr[T]{}
+	for !p.check(token.RIGHT_BRACKET) {
+		element, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+		if !p.match(token.COMMA) {
+			break
 		}
 	}
-	return nil, errors.New("syntax parsing failed")
+	if err := p.consume(token.RIGHT_BRACKET, "Expect ']' after list elements."); err != nil {
+		return nil, err
+	}
+	return &ast.ExprList[T]{
+		Lbracket: lbracket,
+		Elements: elements,
+		Rbracket: p.previous(),
+	}, nil
 }
 
 func (p *parser[T]) advance() token.Token {
@@ -635,6 +1069,15 @@ func (p *parser[T]) check(typ token.TokenType) bool {
 	return p.peek().Type == typ
 }
 
+// checkAt reports whether the token n places after the current one has
+// type typ.
+func (p *parser[T]) checkAt(n int, typ token.TokenType) bool {
+	if p.current+n >= len(p.tokens) {
+		return false
+	}
+	return p.tokens[p.current+n].Type == typ
+}
+
 func (p *parser[T]) match(types ...token.TokenType) bool {
 	for _, typ := range types {
 		if p.check(typ) {
@@ -1,9 +1,12 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/cndoit18/lox/ast"
 	"github.com/cndoit18/lox/evaluator"
+	"github.com/cndoit18/lox/scanner"
 	"github.com/cndoit18/lox/token"
 )
 
@@ -53,3 +56,153 @@ func TestNewParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		stmts int
+		want  []string
+	}{
+		{
+			name:  "ok",
+			src:   "var a = 1;\nprint a;",
+			stmts: 2,
+		},
+		{
+			name:  "multiple errors",
+			src:   "var a = ;\nprint a;\nprint (1 + 2;\nvar b = 3;",
+			stmts: 2,
+			want: []string{
+				"1:9: error: Expect expression.",
+				"3:13: error: Expect ')' after expression.",
+			},
+		},
+		{
+			name:  "invalid assignment target",
+			src:   "var a = 1;\na + 1 = 2;\nprint a;",
+			stmts: 3,
+			want: []string{
+				"2:7: error: Invalid assignment target.",
+			},
+		},
+		{
+			name:  "inside block",
+			src:   "{\nprint ;\nprint 1;\n}\nvar = 2;\nprint 2;",
+			stmts: 2,
+			want: []string{
+				"2:7: error: Expect expression.",
+				"5:5: error: Expect IDENTIFIER after value.",
+			},
+		},
+		{
+			name:  "map missing colon",
+			src:   "var m = {\"a\" 1};\nprint m;",
+			stmts: 1,
+			want: []string{
+				"1:14: error: Expect ':' after map key.",
+			},
+		},
+		{
+			name:  "lambda body",
+			src:   "var f = func (a) a;\nprint f;",
+			stmts: 1,
+			want: []string{
+				"1:18: error: Expect '{' or '=>' before function body.",
+			},
+		},
+		{
+			name:  "export expression",
+			src:   "export 1;\nimport \"m.l\" m;",
+			stmts: 0,
+			want: []string{
+				"1:8: error: Expect declaration after 'export'.",
+				"2:14: error: Expect 'as' after module path.",
+			},
+		},
+		{
+			name:  "loop control",
+			src:   "while (true) {\nprint 1 1\ncontinue\nprint 2 2\nbreak\n}\nprint 3;",
+			stmts: 0,
+			want: []string{
+				"2:9: error: Expect ';' after value.",
+				"4:1: error: Expect ';' after 'continue'.",
+				"6:1: error: Expect ';' after 'break'.",
+				"7:9: error: Expect '}' after block.",
+			},
+		},
+		{
+			name:  "at end",
+			src:   "print 1",
+			stmts: 0,
+			want: []string{
+				"1:8: error: Expect ';' after value.",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan, err := scanner.NewScanner(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("NewScanner() error = %v", err)
+			}
+			stmts, err := NewParser[any](scan.ScanTokens()...).Parse()
+			if len(stmts) != tt.stmts {
+				t.Errorf("Parse() got %d statements, want = %d", len(stmts), tt.stmts)
+			}
+			var got []string
+			if err != nil {
+				got = strings.Split(err.Error(), "\n")
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Parse() error = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "literal", src: "print 12;", want: "12"},
+		{name: "grouping", src: "print  (1 + 2) * 3;", want: "(1 + 2) * 3"},
+		{name: "call", src: "f(a, b).c = 1;", want: "f(a, b).c = 1"},
+		{name: "block", src: "{ var a = 1; }", want: "{ var a = 1; }"},
+		{name: "if", src: "if (a) print 1; else print 2;", want: "if (a) print 1; else print 2"},
+		{name: "for", src: "for (;;) print 1;", want: "for (;;) print 1;"},
+		{name: "map", src: "print {\"a\": 1, 2: b};", want: "{\"a\": 1, 2: b}"},
+		{name: "for in", src: "for (var x in xs) print x;", want: "for (var x in xs) print x"},
+		{name: "arrow", src: "print func (a) => a + 1;", want: "func (a) => a + 1"},
+		{name: "lambda", src: "print func () { return 1; };", want: "func () { return 1; }"},
+		{name: "import", src: "import \"m.l\" as m;", want: "import \"m.l\" as m"},
+		{name: "export", src: "export var a = 1;", want: "export var a = 1"},
+		{name: "multiline", src: "print -\n  x;", want: "-\n  x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan, err := scanner.NewScanner(strings.NewReader(tt.src))
+			if err != nil {
+				t.Fatalf("NewScanner() error = %v", err)
+			}
+			stmts, err := NewParser[any](scan.ScanTokens()...).Parse()
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var span token.Span
+			switch stmt := stmts[0].(type) {
+			case *ast.StmtPrint[any]:
+				span = stmt.Expression.Span()
+			case *ast.StmtExpr[any]:
+				span = stmt.Expression.Span()
+			default:
+				span = stmt.Span()
+			}
+			if got := tt.src[span.Start.Offset:span.End.Offset]; got != tt.want {
+				t.Errorf("Span() got = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cndoit18/lox/interpreter"
+)
+
+// runPrompt reads statements from stdin and evaluates them in a single
+// session, so declarations stay visible to later lines. Input is buffered
+// until its brackets are balanced, and the value of a trailing expression
+// statement is echoed.
+func runPrompt(opts ...interpreter.Option) error {
+	lox := interpreter.New(opts...)
+	scan := bufio.NewScanner(os.Stdin)
+	input := &strings.Builder{}
+
+	fmt.Printf("> ")
+	for scan.Scan() {
+		input.WriteString(scan.Text())
+		input.WriteByte('\n')
+		if incomplete(input.String()) {
+			fmt.Printf("... ")
+			continue
+		}
+
+		value, err := lox.Eval(context.Background(), input.String())
+		input.Reset()
+		if err != nil {
+			lox.Report(err)
+		} else if value != nil {
+			fmt.Println(value)
+		}
+		fmt.Printf("> ")
+	}
+
+	if err := scan.Err(); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// incomplete reports whether src has unclosed parentheses, brackets,
+// braces or block comments and needs more lines before it can be
+// evaluated. A string left open is not waited on, so that the scanner
+// reports it right away.
+func incomplete(src string) bool {
+	depth := 0
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return true
+			}
+			i += end + 3
+		}
+	}
+	return depth > 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want bool
+	}{
+		{name: "statement", src: "print 1;\n", want: false},
+		{name: "open brace", src: "func f() {\n", want: true},
+		{name: "closed brace", src: "func f() {\n}\n", want: false},
+		{name: "open paren", src: "print (1 +\n", want: true},
+		{name: "open bracket", src: "var l = [\n1,\n", want: true},
+		{name: "closed bracket", src: "var l = [\n1,\n2];\n", want: false},
+		{name: "brace in string", src: "print \"{\";\n", want: false},
+		{name: "open string", src: "print \"abc\n", want: false},
+		{name: "open string in paren", src: "print (\"abc\n", want: false},
+		{name: "brace in comment", src: "print 1; // {\n", want: false},
+		{name: "open block comment", src: "/* {\n", want: true},
+		{name: "closed block comment", src: "/* { */ print 1;\n", want: false},
+		{name: "extra close", src: "}\n", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := incomplete(tt.src); got != tt.want {
+				t.Errorf("incomplete(%q) got = %v, want = %v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
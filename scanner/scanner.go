@@ -2,10 +2,10 @@ package scanner
 
 import (
 	"errors"
-	"fmt"
 	"io"
 	"strconv"
 
+	"github.com/cndoit18/lox/diagnostic"
 	"github.com/cndoit18/lox/token"
 )
 
@@ -25,10 +25,18 @@ func NewScanner(src io.Reader) (*scanner, error) {
 func (s *scanner) ScanTokens() []token.Token {
 	for s.scan() {
 		s.start = s.current
+		s.startPos = s.position()
 		s.scanToken()
 	}
 
-	return append(s.tokens, token.Token{Type: token.EOF, Line: s.line})
+	end := s.position()
+	return append(s.tokens, token.Token{
+		Type:   token.EOF,
+		Line:   end.Line,
+		Column: end.Column,
+		Offset: end.Offset,
+		End:    end,
+	})
 }
 
 func (s *scanner) Err() error {
@@ -40,7 +48,31 @@ type scanner struct {
 	buf            []byte
 	current, start int
 	line           int
-	errs           []error
+	// lineStart is the offset of the first byte of the current line.
+	lineStart int
+	startPos  token.Position
+	errs      []error
+}
+
+func (s *scanner) position() token.Position {
+	return token.Position{
+		Offset: s.current,
+		Line:   s.line,
+		Column: s.current - s.lineStart + 1,
+	}
+}
+
+// span returns the range from the start of the current token to here.
+func (s *scanner) span() token.Span {
+	return token.Span{
+		Start: s.startPos,
+		End:   s.position(),
+	}
+}
+
+func (s *scanner) newline() {
+	s.line++
+	s.lineStart = s.current
 }
 
 func (s *scanner) scan() bool {
@@ -66,6 +98,10 @@ func (s *scanner) peek() byte {
 	return 0
 }
 
+func (s *scanner) previous() byte {
+	return s.buf[s.current-1]
+}
+
 func (s *scanner) peekNext() byte {
 	if s.current+1 < len(s.buf) {
 		return s.buf[s.current+1]
@@ -113,8 +149,14 @@ func (s *scanner) scanToken() {
 		s.appendToken(token.LEFT_BRACE)
 	case '}':
 		s.appendToken(token.RIGHT_BRACE)
+	case '[':
+		s.appendToken(token.LEFT_BRACKET)
+	case ']':
+		s.appendToken(token.RIGHT_BRACKET)
 	case ',':
 		s.appendToken(token.COMMA)
+	case ':':
+		s.appendToken(token.COLON)
 	case '.':
 		s.appendToken(token.DOT)
 	case '-':
@@ -128,6 +170,10 @@ func (s *scanner) scanToken() {
 	case '!':
 		s.appendToken(ternary(s.match('='), token.BANG_EQUAL, token.BANG))
 	case '=':
+		if s.match('>') {
+			s.appendToken(token.ARROW)
+			return
+		}
 		s.appendToken(ternary(s.match('='), token.EQUAL_EQUAL, token.EQUAL))
 	case '<':
 		s.appendToken(ternary(s.match('='), token.LESS_EQUAL, token.LESS))
@@ -140,14 +186,14 @@ func (s *scanner) scanToken() {
 			}
 		} else if s.match('*') {
 			for !(s.peek() == '*' && s.peekNext() == '/') && s.peek() != 0 {
-				if s.peek() == '\n' {
-					s.line++
-				}
 				s.advance()
+				if s.previous() == '\n' {
+					s.newline()
+				}
 			}
 
 			if s.peek() == 0 {
-				s.errs = append(s.errs, newLineError(s.line, string(s.buf[s.start:s.current]), "Unterminated notes."))
+				s.errs = append(s.errs, newLineError(s.span(), "Unterminated notes."))
 				return
 			}
 
@@ -163,7 +209,7 @@ func (s *scanner) scanToken() {
 		fallthrough
 	case '\t':
 	case '\n':
-		s.line++
+		s.newline()
 	case '"':
 		s.readString()
 	default:
@@ -172,21 +218,21 @@ func (s *scanner) scanToken() {
 		} else if isAlpha(c) {
 			s.identifier()
 		} else {
-			s.errs = append(s.errs, newLineError(s.line, "", "Unterminated character."))
+			s.errs = append(s.errs, newLineError(s.span(), "Unterminated character."))
 		}
 	}
 }
 
 func (s *scanner) readString() {
 	for s.peek() != '"' && s.peek() != 0 {
-		if s.peek() == '\n' {
-			s.line++
-		}
 		s.advance()
+		if s.previous() == '\n' {
+			s.newline()
+		}
 	}
 
 	if s.peek() == 0 {
-		s.errs = append(s.errs, newLineError(s.line, string(s.buf[s.start:s.current]), "Unterminated string."))
+		s.errs = append(s.errs, newLineError(s.span(), "Unterminated string."))
 		return
 	}
 
@@ -194,7 +240,7 @@ func (s *scanner) readString() {
 	s.advance()
 	value, err := strconv.Unquote(string(s.buf[s.start:s.current]))
 	if err != nil {
-		s.errs = append(s.errs, newLineError(s.line, "", err.Error()))
+		s.errs = append(s.errs, newLineError(s.span(), err.Error()))
 	}
 	s.appendToken(token.STRING, withLiteral(value))
 }
@@ -213,7 +259,7 @@ func (s *scanner) readNumber() {
 	literal := s.buf[s.start:s.current]
 	value, err := strconv.ParseFloat(string(literal), 64)
 	if err != nil {
-		s.errs = append(s.errs, newLineError(s.line, "", err.Error()))
+		s.errs = append(s.errs, newLineError(s.span(), err.Error()))
 		return
 	}
 	s.appendToken(token.NUMBER, withLiteral(value))
@@ -244,7 +290,10 @@ func withLiteral(literal any) tokenOpt {
 func (s *scanner) appendToken(typ token.TokenType, opts ...tokenOpt) {
 	token := token.Token{
 		Type:   typ,
-		Line:   s.line,
+		Line:   s.startPos.Line,
+		Column: s.startPos.Column,
+		Offset: s.startPos.Offset,
+		End:    s.position(),
 		Lexeme: string(s.buf[s.start:s.current]),
 	}
 	for _, opt := range opts {
@@ -256,19 +305,25 @@ func (s *scanner) appendToken(typ token.TokenType, opts ...tokenOpt) {
 
 // errors
 type lineError struct {
-	line    int
-	where   string
+	span    token.Span
 	message string
 }
 
-func newLineError(line int, where string, msg string) error {
+func newLineError(span token.Span, msg string) error {
 	return &lineError{
-		line:    line,
-		where:   where,
+		span:    span,
 		message: msg,
 	}
 }
 
 func (l *lineError) Error() string {
-	return fmt.Sprintf("[line %d] Error %s: %s", l.line, l.where, l.message)
+	return l.Diagnostic().String()
+}
+
+func (l *lineError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     l.span,
+		Message:  l.message,
+	}
 }
@@ -98,3 +98,31 @@ func TestNewScanner(t *testing.T) {
 		})
 	}
 }
+
+func TestPosition(t *testing.T) {
+	src := "var x = 1;\n  print /* a\nb */ x;"
+	got, err := NewScanner(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("NewScanner() error = %v", err)
+	}
+	want := []token.Span{
+		{Start: token.Position{Offset: 0, Line: 1, Column: 1}, End: token.Position{Offset: 3, Line: 1, Column: 4}},
+		{Start: token.Position{Offset: 4, Line: 1, Column: 5}, End: token.Position{Offset: 5, Line: 1, Column: 6}},
+		{Start: token.Position{Offset: 6, Line: 1, Column: 7}, End: token.Position{Offset: 7, Line: 1, Column: 8}},
+		{Start: token.Position{Offset: 8, Line: 1, Column: 9}, End: token.Position{Offset: 9, Line: 1, Column: 10}},
+		{Start: token.Position{Offset: 9, Line: 1, Column: 10}, End: token.Position{Offset: 10, Line: 1, Column: 11}},
+		{Start: token.Position{Offset: 13, Line: 2, Column: 3}, End: token.Position{Offset: 18, Line: 2, Column: 8}},
+		{Start: token.Position{Offset: 29, Line: 3, Column: 6}, End: token.Position{Offset: 30, Line: 3, Column: 7}},
+		{Start: token.Position{Offset: 30, Line: 3, Column: 7}, End: token.Position{Offset: 31, Line: 3, Column: 8}},
+		{Start: token.Position{Offset: 31, Line: 3, Column: 8}, End: token.Position{Offset: 31, Line: 3, Column: 8}},
+	}
+	tokens := got.ScanTokens()
+	if len(tokens) != len(want) {
+		t.Fatalf("The number of tokens is different. token = %d, want = %d", len(tokens), len(want))
+	}
+	for i, token := range tokens {
+		if token.Span() != want[i] {
+			t.Errorf("Span() of %q got = %v, want = %v", token.Lexeme, token.Span(), want[i])
+		}
+	}
+}
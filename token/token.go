@@ -7,8 +7,56 @@ type Token struct {
 	Lexeme  string
 	Literal any
 	Line    int
+	// Column is the 1-based byte column of the first character.
+	Column int
+	// Offset is the 0-based byte offset of the first character.
+	Offset int
+	// End is the position just past the last character.
+	End Position
 }
 
 func (t Token) String() string {
 	return fmt.Sprintf("%d %s %v", t.Type, t.Lexeme, t.Literal)
 }
+
+// Pos returns the position of the first character.
+func (t Token) Pos() Position {
+	return Position{
+		Offset: t.Offset,
+		Line:   t.Line,
+		Column: t.Column,
+	}
+}
+
+// Span returns the range of source covered by the token.
+func (t Token) Span() Span {
+	return Span{
+		Start: t.Pos(),
+		End:   t.End,
+	}
+}
+
+// Position is a location in the source.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Span is a range of source, End being exclusive.
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// To returns the span from the start of s to the end of end.
+func (s Span) To(end Span) Span {
+	return Span{
+		Start: s.Start,
+		End:   end.End,
+	}
+}
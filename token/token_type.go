@@ -8,7 +8,10 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
 	COMMA
+	COLON
 	DOT
 	MINUS
 	PLUS
@@ -17,6 +20,7 @@ const (
 	STAR
 
 	// One or two character tokens.
+	ARROW
 	BANG
 	BANG_EQUAL
 	EQUAL
@@ -33,19 +37,29 @@ const (
 
 	// Keywords.
 	AND
+	AS
+	BREAK
+	CATCH
 	CLASS
+	CONTINUE
 	ELSE
+	EXPORT
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
+	IN
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
@@ -53,20 +67,30 @@ const (
 )
 
 var Keywords = map[string]TokenType{
-	"and":    AND,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"for":    FOR,
-	"func":   FUN,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"as":       AS,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"export":   EXPORT,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"for":      FOR,
+	"func":     FUN,
+	"if":       IF,
+	"import":   IMPORT,
+	"in":       IN,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
 }
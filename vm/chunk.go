@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"github.com/cndoit18/lox/token"
+)
+
+type OpCode byte
+
+// Operands follow their opcode in the code. Constant and name operands
+// are two-byte indexes into the constant pool, jump offsets are two bytes,
+// and slot, upvalue and argument counts are one byte.
+const (
+	OpConstant OpCode = iota
+	OpNil
+	OpHole
+	OpTrue
+	OpFalse
+	OpPop
+	OpGetLocal
+	OpSetLocal
+	OpGetGlobal
+	OpDefineGlobal
+	OpSetGlobal
+	OpGetUpvalue
+	OpSetUpvalue
+	OpGetProperty
+	OpSetProperty
+	OpGetSuper
+	OpGetIndex
+	OpSetIndex
+	OpEqual
+	OpGreater
+	OpGreaterEqual
+	OpLess
+	OpLessEqual
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpNot
+	OpNegate
+	OpPrint
+	OpJump
+	OpJumpIfFalse
+	OpJumpIfDeclared
+	OpLoop
+	OpCall
+	OpClosure
+	OpCloseUpvalue
+	OpReturn
+	OpClass
+	OpInherit
+	OpMethod
+	OpList
+	OpMap
+	OpThrow
+	OpTry
+	OpTryFinally
+	OpEndTry
+	OpRethrow
+	OpIter
+	OpForIter
+	OpImport
+)
+
+var opNames = [...]string{
+	OpConstant:       "CONSTANT",
+	OpNil:            "NIL",
+	OpHole:           "HOLE",
+	OpTrue:           "TRUE",
+	OpFalse:          "FALSE",
+	OpPop:            "POP",
+	OpGetLocal:       "GET_LOCAL",
+	OpSetLocal:       "SET_LOCAL",
+	OpGetGlobal:      "GET_GLOBAL",
+	OpDefineGlobal:   "DEFINE_GLOBAL",
+	OpSetGlobal:      "SET_GLOBAL",
+	OpGetUpvalue:     "GET_UPVALUE",
+	OpSetUpvalue:     "SET_UPVALUE",
+	OpGetProperty:    "GET_PROPERTY",
+	OpSetProperty:    "SET_PROPERTY",
+	OpGetSuper:       "GET_SUPER",
+	OpGetIndex:       "GET_INDEX",
+	OpSetIndex:       "SET_INDEX",
+	OpEqual:          "EQUAL",
+	OpGreater:        "GREATER",
+	OpGreaterEqual:   "GREATER_EQUAL",
+	OpLess:           "LESS",
+	OpLessEqual:      "LESS_EQUAL",
+	OpAdd:            "ADD",
+	OpSubtract:       "SUBTRACT",
+	OpMultiply:       "MULTIPLY",
+	OpDivide:         "DIVIDE",
+	OpNot:            "NOT",
+	OpNegate:         "NEGATE",
+	OpPrint:          "PRINT",
+	OpJump:           "JUMP",
+	OpJumpIfFalse:    "JUMP_IF_FALSE",
+	OpJumpIfDeclared: "JUMP_IF_DECLARED",
+	OpLoop:           "LOOP",
+	OpCall:           "CALL",
+	OpClosure:        "CLOSURE",
+	OpCloseUpvalue:   "CLOSE_UPVALUE",
+	OpReturn:         "RETURN",
+	OpClass:          "CLASS",
+	OpInherit:        "INHERIT",
+	OpMethod:         "METHOD",
+	OpList:           "LIST",
+	OpMap:            "MAP",
+	OpThrow:          "THROW",
+	OpTry:            "TRY",
+	OpTryFinally:     "TRY_FINALLY",
+	OpEndTry:         "END_TRY",
+	OpRethrow:        "RETHROW",
+	OpIter:           "ITER",
+	OpForIter:        "FOR_ITER",
+	OpImport:         "IMPORT",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return "UNKNOWN"
+}
+
+// Chunk is the bytecode of one function.
+type Chunk struct {
+	Code []byte
+	// Spans holds the source range of the instruction each byte belongs
+	// to, for error messages.
+	Spans     []token.Span
+	Constants []any
+	// constants maps values already in the pool to their index.
+	constants map[any]int
+}
+
+func (c *Chunk) write(b byte, span token.Span) {
+	c.Code = append(c.Code, b)
+	c.Spans = append(c.Spans, span)
+}
+
+// addConstant returns the index of value in the constant pool, adding it
+// if it is not there yet.
+func (c *Chunk) addConstant(value any) int {
+	if i, ok := c.constants[value]; ok {
+		return i
+	}
+	if c.constants == nil {
+		c.constants = map[any]int{}
+	}
+	c.Constants = append(c.Constants, value)
+	c.constants[value] = len(c.Constants) - 1
+	return len(c.Constants) - 1
+}
@@ -0,0 +1,951 @@
+package vm
+
+import (
+	"errors"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/token"
+)
+
+type functionKind int
+
+const (
+	kindScript functionKind = iota
+	kindFunction
+	kindMethod
+	kindInitializer
+)
+
+// lambdaName is the name anonymous functions are reported under.
+const lambdaName = "lambda"
+
+type local struct {
+	name string
+	// depth is -1 while the variable's initializer is compiled.
+	depth    int
+	captured bool
+	// hoisted is set for a function declared further down its block, whose
+	// slot holds a hole until the declaration runs.
+	hoisted bool
+}
+
+type upvalueRef struct {
+	index int
+	// local is set when index is a slot of the enclosing function rather
+	// than one of its upvalues.
+	local bool
+}
+
+type loop struct {
+	// breakLocals and continueLocals are the number of locals left on the
+	// stack when break and continue jump.
+	breakLocals, continueLocals int
+	// breaks and continues are the jumps to patch once their targets are
+	// known.
+	breaks, continues []int
+	// tries is the number of try statements enclosing the loop.
+	tries int
+}
+
+// tryRegion is a try statement whose body or catch clause is being
+// compiled.
+type tryRegion struct {
+	// handlers is the number of handlers the statement has installed at
+	// this point, which return, break and continue must remove.
+	handlers int
+	finally  *ast.StmtBlock[any]
+	// locals and loops are the numbers of locals and loops outside of the
+	// statement.
+	locals, loops int
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+// compiler compiles the body of one function.
+type compiler struct {
+	enclosing  *compiler
+	function   *Function
+	kind       functionKind
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+	loops      []*loop
+	tries      []*tryRegion
+	class      *classCompiler
+	// initializing is the global whose initializer is being compiled.
+	initializing string
+	errs         *[]error
+}
+
+// Compile compiles a script into the function that runs its top-level
+// code. The function returns the value of the last statement when that
+// is an expression statement, and nil otherwise.
+func Compile(stmts []ast.Stmt[any]) (*Function, error) {
+	errs := []error{}
+	c := newCompiler(nil, kindScript, "", &errs)
+	for n, stmt := range stmts {
+		if expr, ok := stmt.(*ast.StmtExpr[any]); ok && n == len(stmts)-1 {
+			c.expression(expr.Expression)
+			c.emitOp(OpReturn, expr.Span())
+			return c.function, errors.Join(errs...)
+		}
+		c.statement(stmt)
+	}
+	end := token.Span{}
+	if len(stmts) > 0 {
+		end = stmts[len(stmts)-1].Span()
+	}
+	c.emitReturn(end)
+	return c.function, errors.Join(errs...)
+}
+
+func newCompiler(enclosing *compiler, kind functionKind, name string, errs *[]error) *compiler {
+	c := &compiler{
+		enclosing: enclosing,
+		function:  &Function{Name: name},
+		kind:      kind,
+		errs:      errs,
+	}
+	if enclosing != nil {
+		c.class = enclosing.class
+	}
+	// slot 0 holds the function being called, or the receiver of a method.
+	receiver := ""
+	if kind == kindMethod || kind == kindInitializer {
+		receiver = "this"
+	}
+	c.locals = append(c.locals, local{name: receiver})
+	return c
+}
+
+func (c *compiler) error(t token.Token, msg string) {
+	c.errorAt(t.Span(), msg)
+}
+
+func (c *compiler) errorAt(span token.Span, msg string) {
+	*c.errs = append(*c.errs, &compileError{span: span, msg: msg})
+}
+
+func (c *compiler) chunk() *Chunk {
+	return &c.function.Chunk
+}
+
+func (c *compiler) emit(span token.Span, bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, span)
+	}
+}
+
+func (c *compiler) emitOp(op OpCode, span token.Span) {
+	c.emit(span, byte(op))
+}
+
+// emitConstant emits op with the index of value in the constant pool as
+// its operand.
+func (c *compiler) emitConstant(op OpCode, value any, span token.Span) {
+	index := c.chunk().addConstant(value)
+	if index > 0xffff {
+		c.errorAt(span, "Too many constants in one chunk.")
+	}
+	c.emit(span, byte(op), byte(index>>8), byte(index))
+}
+
+// emitJump emits a forward jump and returns the offset of its operand,
+// to be patched once the target is known.
+func (c *compiler) emitJump(op OpCode, span token.Span) int {
+	c.emit(span, byte(op), 0xff, 0xff)
+	return len(c.chunk().Code) - 2
+}
+
+// patchJump makes the jump at offset land at the end of the code.
+func (c *compiler) patchJump(offset int, span token.Span) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > 0xffff {
+		c.errorAt(span, "Too much code to jump over.")
+	}
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *compiler) emitLoop(start int, span token.Span) {
+	c.emitOp(OpLoop, span)
+	offset := len(c.chunk().Code) - start + 2
+	if offset > 0xffff {
+		c.errorAt(span, "Loop body too large.")
+	}
+	c.emit(span, byte(offset>>8), byte(offset))
+}
+
+func (c *compiler) emitReturn(span token.Span) {
+	if c.kind == kindInitializer {
+		c.emit(span, byte(OpGetLocal), 0)
+	} else {
+		c.emitOp(OpNil, span)
+	}
+	c.emitOp(OpReturn, span)
+}
+
+func (c *compiler) statement(s ast.Stmt[any]) {
+	s.Accept(c)
+}
+
+func (c *compiler) expression(e ast.Expr[any]) {
+	e.Accept(c)
+}
+
+func (c *compiler) beginScope() {
+	c.scopeDepth++
+}
+
+func (c *compiler) endScope(span token.Span) {
+	c.scopeDepth--
+	for len(c.locals) > 0 && c.locals[len(c.locals)-1].depth > c.scopeDepth {
+		if c.locals[len(c.locals)-1].captured {
+			c.emitOp(OpCloseUpvalue, span)
+		} else {
+			c.emitOp(OpPop, span)
+		}
+		c.locals = c.locals[:len(c.locals)-1]
+	}
+}
+
+// popLocals emits the code that discards the locals above the first n,
+// without forgetting them, for jumps out of their scope.
+func (c *compiler) popLocals(n int, span token.Span) {
+	for i := len(c.locals) - 1; i >= n; i-- {
+		if c.locals[i].captured {
+			c.emitOp(OpCloseUpvalue, span)
+		} else {
+			c.emitOp(OpPop, span)
+		}
+	}
+}
+
+func (c *compiler) addLocal(name token.Token) {
+	if len(c.locals) == 256 {
+		c.error(name, "Too many local variables in function.")
+	}
+	c.locals = append(c.locals, local{name: name.Lexeme, depth: -1})
+}
+
+// addHidden adds a local that holds compiler state on the stack and can't
+// be named by scripts.
+func (c *compiler) addHidden(span token.Span) {
+	c.addLocal(token.Token{Line: span.Start.Line, Column: span.Start.Column, Offset: span.Start.Offset, End: span.End})
+	c.markInitialized()
+}
+
+func (c *compiler) markInitialized() {
+	if c.scopeDepth == 0 {
+		return
+	}
+	c.locals[len(c.locals)-1].depth = c.scopeDepth
+}
+
+// declareVariable adds name to the current scope. Variables at the top
+// level of a script are globals, which need no declaration.
+func (c *compiler) declareVariable(name token.Token) {
+	if c.scopeDepth == 0 {
+		return
+	}
+	c.addLocal(name)
+}
+
+// defineVariable makes the value on top of the stack the value of name.
+func (c *compiler) defineVariable(name token.Token) {
+	if c.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitConstant(OpDefineGlobal, name.Lexeme, name.Span())
+}
+
+// hoist reserves slots for the functions that stmts declare in the current
+// local scope, so that functions declared before them can call them:
+// mutually recursive functions can be declared in any order.
+func (c *compiler) hoist(stmts []ast.Stmt[any]) {
+	if c.scopeDepth == 0 {
+		return
+	}
+	hoisted := map[string]bool{}
+	for _, stmt := range stmts {
+		if function, ok := stmt.(*ast.StmtFunction[any]); ok && !hoisted[function.Name.Lexeme] {
+			hoisted[function.Name.Lexeme] = true
+			c.emitOp(OpHole, function.Name.Span())
+			c.addLocal(function.Name)
+			c.markInitialized()
+			c.locals[len(c.locals)-1].hoisted = true
+		}
+	}
+}
+
+// resolveLocal returns the slot of the local called name, or -1. Reading
+// a variable in its own initializer is only an error in the function that
+// declares it; closures may capture it before it is defined. Functions
+// whose declarations have not been compiled yet are only seen when
+// hoisted is set, by the functions nested in this one.
+func (c *compiler) resolveLocal(name token.Token, read, hoisted bool) int {
+	for i := len(c.locals) - 1; i >= 0; i-- {
+		if c.locals[i].hoisted && !hoisted {
+			continue
+		}
+		if c.locals[i].name == name.Lexeme {
+			if read && c.locals[i].depth == -1 {
+				c.error(name, "Can't read local variable in its own initializer.")
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue returns the upvalue that captures the variable called
+// name, or -1, and reports whether it is a hoisted function.
+func (c *compiler) resolveUpvalue(name token.Token, hoisted bool) (int, bool) {
+	if c.enclosing == nil {
+		return -1, false
+	}
+	if slot := c.enclosing.resolveLocal(name, false, hoisted); slot >= 0 {
+		c.enclosing.locals[slot].captured = true
+		return c.addUpvalue(slot, true, name), c.enclosing.locals[slot].hoisted
+	}
+	if index, hoisted := c.enclosing.resolveUpvalue(name, hoisted); index >= 0 {
+		return c.addUpvalue(index, false, name), hoisted
+	}
+	return -1, false
+}
+
+func (c *compiler) addUpvalue(index int, isLocal bool, name token.Token) int {
+	for i, upvalue := range c.upvalues {
+		if upvalue.index == index && upvalue.local == isLocal {
+			return i
+		}
+	}
+	if len(c.upvalues) == 256 {
+		c.error(name, "Too many closure variables in function.")
+	}
+	c.upvalues = append(c.upvalues, upvalueRef{index: index, local: isLocal})
+	return len(c.upvalues) - 1
+}
+
+// getVariable emits the code that pushes the value of name.
+func (c *compiler) getVariable(name token.Token) {
+	c.loadVariable(name, true)
+}
+
+// loadVariable emits the code that pushes the value of name, which may be
+// a hoisted function unless it is the name that function shadows that is
+// loaded.
+func (c *compiler) loadVariable(name token.Token, hoisted bool) {
+	if slot := c.resolveLocal(name, true, false); slot >= 0 {
+		c.emit(name.Span(), byte(OpGetLocal), byte(slot))
+		return
+	}
+	if index, hoisted := c.resolveUpvalue(name, hoisted); index >= 0 {
+		c.emit(name.Span(), byte(OpGetUpvalue), byte(index))
+		if hoisted {
+			// until the declaration runs, the name refers to the
+			// variable the function shadows.
+			declared := c.emitJump(OpJumpIfDeclared, name.Span())
+			c.loadVariable(name, false)
+			c.patchJump(declared, name.Span())
+		}
+		return
+	}
+	if c.kind == kindScript && c.scopeDepth == 0 && c.initializing == name.Lexeme {
+		c.error(name, "Can't read local variable in its own initializer.")
+	}
+	c.emitConstant(OpGetGlobal, name.Lexeme, name.Span())
+}
+
+// setVariable emits the code that assigns the value on top of the stack
+// to name, leaving it there.
+func (c *compiler) setVariable(name token.Token) {
+	c.storeVariable(name, true)
+}
+
+// storeVariable is setVariable for loadVariable.
+func (c *compiler) storeVariable(name token.Token, hoisted bool) {
+	if slot := c.resolveLocal(name, false, false); slot >= 0 {
+		c.emit(name.Span(), byte(OpSetLocal), byte(slot))
+		return
+	}
+	if index, hoisted := c.resolveUpvalue(name, hoisted); index >= 0 {
+		if !hoisted {
+			c.emit(name.Span(), byte(OpSetUpvalue), byte(index))
+			return
+		}
+		c.emit(name.Span(), byte(OpGetUpvalue), byte(index))
+		declared := c.emitJump(OpJumpIfDeclared, name.Span())
+		c.storeVariable(name, false)
+		done := c.emitJump(OpJump, name.Span())
+		c.patchJump(declared, name.Span())
+		c.emitOp(OpPop, name.Span())
+		c.emit(name.Span(), byte(OpSetUpvalue), byte(index))
+		c.patchJump(done, name.Span())
+		return
+	}
+	c.emitConstant(OpSetGlobal, name.Lexeme, name.Span())
+}
+
+// compileFunction compiles a function body and emits the closure that creates it.
+func (c *compiler) compileFunction(kind functionKind, name string, params []token.Token, body *ast.StmtBlock[any], span token.Span) {
+	fc := newCompiler(c, kind, name, c.errs)
+	fc.beginScope()
+	fc.function.Arity = len(params)
+	for _, param := range params {
+		fc.addLocal(param)
+		fc.markInitialized()
+	}
+	fc.hoist(body.Statements)
+	for _, stmt := range body.Statements {
+		fc.statement(stmt)
+	}
+	fc.emitReturn(body.Rbrace.Span())
+
+	fc.function.Upvalues = len(fc.upvalues)
+	c.emitConstant(OpClosure, fc.function, span)
+	for _, upvalue := range fc.upvalues {
+		isLocal := byte(0)
+		if upvalue.local {
+			isLocal = 1
+		}
+		c.emit(span, isLocal, byte(upvalue.index))
+	}
+}
+
+// unwind emits the code that leaves the try statements from the n-th
+// outwards: their handlers are removed and their finally blocks run.
+func (c *compiler) unwind(n int, span token.Span) {
+	for i := len(c.tries) - 1; i >= n; i-- {
+		region := c.tries[i]
+		for h := 0; h < region.handlers; h++ {
+			c.emitOp(OpEndTry, span)
+		}
+		if region.finally == nil {
+			continue
+		}
+		// the finally block sees neither the locals nor the loops of the
+		// statement it belongs to.
+		tries, loops := c.tries, c.loops
+		c.tries, c.loops = c.tries[:i], c.loops[:region.loops]
+		names := []string{}
+		for l := region.locals; l < len(c.locals); l++ {
+			names = append(names, c.locals[l].name)
+			c.locals[l].name = ""
+		}
+		c.statement(region.finally)
+		for l, name := range names {
+			c.locals[region.locals+l].name = name
+		}
+		c.tries, c.loops = tries, loops
+	}
+}
+
+// topLevel reports whether statements are compiled in the global scope
+// of a script.
+func (c *compiler) topLevel() bool {
+	return c.kind == kindScript && c.scopeDepth == 0
+}
+
+func (c *compiler) VisitorStmtPrint(s *ast.StmtPrint[any]) any {
+	c.expression(s.Expression)
+	c.emitOp(OpPrint, s.Keyword.Span())
+	return nil
+}
+
+func (c *compiler) VisitorStmtExpr(s *ast.StmtExpr[any]) any {
+	c.expression(s.Expression)
+	c.emitOp(OpPop, s.Span())
+	return nil
+}
+
+func (c *compiler) VisitorStmtVar(s *ast.StmtVar[any]) any {
+	c.declareVariable(s.Name)
+	if c.topLevel() {
+		c.initializing = s.Name.Lexeme
+	}
+	if s.Initializer != nil {
+		c.expression(s.Initializer)
+	} else {
+		c.emitOp(OpNil, s.Name.Span())
+	}
+	c.initializing = ""
+	c.defineVariable(s.Name)
+	return nil
+}
+
+func (c *compiler) VisitorStmtBlock(s *ast.StmtBlock[any]) any {
+	c.beginScope()
+	c.hoist(s.Statements)
+	for _, stmt := range s.Statements {
+		c.statement(stmt)
+	}
+	c.endScope(s.Rbrace.Span())
+	return nil
+}
+
+func (c *compiler) VisitorStmtIf(s *ast.StmtIf[any]) any {
+	c.expression(s.Condition)
+	thenJump := c.emitJump(OpJumpIfFalse, s.Keyword.Span())
+	c.emitOp(OpPop, s.Keyword.Span())
+	c.statement(s.ThenBranch)
+	elseJump := c.emitJump(OpJump, s.Keyword.Span())
+	c.patchJump(thenJump, s.Keyword.Span())
+	c.emitOp(OpPop, s.Keyword.Span())
+	if s.ElseBranch != nil {
+		c.statement(s.ElseBranch)
+	}
+	c.patchJump(elseJump, s.Keyword.Span())
+	return nil
+}
+
+func (c *compiler) VisitorStmtWhile(s *ast.StmtWhile[any]) any {
+	span := s.Keyword.Span()
+	start := len(c.chunk().Code)
+	c.expression(s.Condition)
+	exit := c.emitJump(OpJumpIfFalse, span)
+	c.emitOp(OpPop, span)
+
+	l := &loop{breakLocals: len(c.locals), continueLocals: len(c.locals), tries: len(c.tries)}
+	c.loops = append(c.loops, l)
+	c.statement(s.Body)
+	c.loops = c.loops[:len(c.loops)-1]
+
+	// the increment of a for loop runs on continue too.
+	for _, jump := range l.continues {
+		c.patchJump(jump, span)
+	}
+	if s.Increment != nil {
+		c.expression(s.Increment)
+		c.emitOp(OpPop, span)
+	}
+	c.emitLoop(start, span)
+
+	c.patchJump(exit, span)
+	c.emitOp(OpPop, span)
+	for _, jump := range l.breaks {
+		c.patchJump(jump, span)
+	}
+	return nil
+}
+
+func (c *compiler) VisitorStmtForIn(s *ast.StmtForIn[any]) any {
+	span := s.Keyword.Span()
+	c.beginScope()
+	c.expression(s.Iterable)
+	c.emitOp(OpIter, span)
+	c.addHidden(span)
+
+	start := len(c.chunk().Code)
+	exit := c.emitJump(OpForIter, span)
+	l := &loop{breakLocals: len(c.locals), continueLocals: len(c.locals) + 1, tries: len(c.tries)}
+	c.loops = append(c.loops, l)
+
+	// the element pushed by OpForIter is a fresh variable every iteration,
+	// so closures created in the body capture the element they were
+	// created for.
+	c.beginScope()
+	c.addLocal(s.Name)
+	c.markInitialized()
+	c.statement(s.Body)
+	for _, jump := range l.continues {
+		c.patchJump(jump, span)
+	}
+	c.endScope(span)
+	c.loops = c.loops[:len(c.loops)-1]
+	c.emitLoop(start, span)
+
+	c.patchJump(exit, span)
+	for _, jump := range l.breaks {
+		c.patchJump(jump, span)
+	}
+	c.endScope(span)
+	return nil
+}
+
+func (c *compiler) VisitorStmtBreak(s *ast.StmtBreak[any]) any {
+	if len(c.loops) == 0 {
+		c.error(s.Keyword, "Can't use 'break' outside of a loop.")
+		return nil
+	}
+	l := c.loops[len(c.loops)-1]
+	c.unwind(l.tries, s.Keyword.Span())
+	c.popLocals(l.breakLocals, s.Keyword.Span())
+	l.breaks = append(l.breaks, c.emitJump(OpJump, s.Keyword.Span()))
+	return nil
+}
+
+func (c *compiler) VisitorStmtContinue(s *ast.StmtContinue[any]) any {
+	if len(c.loops) == 0 {
+		c.error(s.Keyword, "Can't use 'continue' outside of a loop.")
+		return nil
+	}
+	l := c.loops[len(c.loops)-1]
+	c.unwind(l.tries, s.Keyword.Span())
+	c.popLocals(l.continueLocals, s.Keyword.Span())
+	l.continues = append(l.continues, c.emitJump(OpJump, s.Keyword.Span()))
+	return nil
+}
+
+func (c *compiler) VisitorStmtFunction(s *ast.StmtFunction[any]) any {
+	for slot := len(c.locals) - 1; slot >= 0 && c.locals[slot].depth == c.scopeDepth; slot-- {
+		if c.locals[slot].hoisted && c.locals[slot].name == s.Name.Lexeme {
+			c.locals[slot].hoisted = false
+			c.compileFunction(kindFunction, s.Name.Lexeme, s.Params, s.Body.(*ast.StmtBlock[any]), s.Name.Span())
+			c.emit(s.Name.Span(), byte(OpSetLocal), byte(slot))
+			c.emitOp(OpPop, s.Name.Span())
+			return nil
+		}
+	}
+	c.declareVariable(s.Name)
+	c.markInitialized()
+	c.compileFunction(kindFunction, s.Name.Lexeme, s.Params, s.Body.(*ast.StmtBlock[any]), s.Name.Span())
+	c.defineVariable(s.Name)
+	return nil
+}
+
+func (c *compiler) VisitorStmtReturn(s *ast.StmtReturn[any]) any {
+	span := s.Keyword.Span()
+	if c.kind == kindScript {
+		c.error(s.Keyword, "Can't return from top-level code.")
+		return nil
+	}
+	switch {
+	case s.Value != nil && c.kind == kindInitializer:
+		c.error(s.Keyword, "Can't return a value from an initializer.")
+		return nil
+	case s.Value != nil:
+		c.expression(s.Value)
+	case c.kind == kindInitializer:
+		c.emit(span, byte(OpGetLocal), 0)
+	default:
+		c.emitOp(OpNil, span)
+	}
+
+	if len(c.tries) > 0 {
+		// keep the value in a slot of its own while finally blocks run.
+		c.addHidden(span)
+		slot := len(c.locals) - 1
+		c.unwind(0, span)
+		c.emit(span, byte(OpGetLocal), byte(slot))
+		c.locals = c.locals[:slot]
+	}
+	c.emitOp(OpReturn, span)
+	return nil
+}
+
+func (c *compiler) VisitorStmtClass(s *ast.StmtClass[any]) any {
+	c.declareVariable(s.Name)
+	c.emitConstant(OpClass, s.Name.Lexeme, s.Name.Span())
+	c.defineVariable(s.Name)
+
+	class := &classCompiler{enclosing: c.class}
+	c.class = class
+	defer func() { c.class = class.enclosing }()
+
+	if s.Superclass != nil {
+		if s.Superclass.Name.Lexeme == s.Name.Lexeme {
+			c.error(s.Superclass.Name, "A class can't inherit from itself.")
+		}
+		c.getVariable(s.Superclass.Name)
+		// super is a local of a scope around the methods, so that they
+		// capture it.
+		c.beginScope()
+		c.addLocal(token.Token{Lexeme: "super"})
+		c.markInitialized()
+		c.getVariable(s.Name)
+		c.emitOp(OpInherit, s.Superclass.Name.Span())
+		class.hasSuperclass = true
+	}
+
+	c.getVariable(s.Name)
+	for _, method := range s.Methods {
+		kind := kindMethod
+		if method.Name.Lexeme == "init" {
+			kind = kindInitializer
+		}
+		c.compileFunction(kind, method.Name.Lexeme, method.Params, method.Body.(*ast.StmtBlock[any]), method.Name.Span())
+		c.emitConstant(OpMethod, method.Name.Lexeme, method.Name.Span())
+	}
+	c.emitOp(OpPop, s.Name.Span())
+
+	if class.hasSuperclass {
+		c.endScope(s.Name.Span())
+	}
+	return nil
+}
+
+func (c *compiler) VisitorStmtThrow(s *ast.StmtThrow[any]) any {
+	c.expression(s.Value)
+	c.emitOp(OpThrow, s.Keyword.Span())
+	return nil
+}
+
+// VisitorStmtTry installs a handler for the catch clause and another for
+// the finally block around the body. The handler of the finally block runs
+// it and raises the error again; the other ways out of the statement run
+// a copy of it.
+func (c *compiler) VisitorStmtTry(s *ast.StmtTry[any]) any {
+	span := s.Keyword.Span()
+	region := &tryRegion{finally: s.Finally, locals: len(c.locals), loops: len(c.loops)}
+	var finallyHandler, catchHandler int
+	if s.Finally != nil {
+		finallyHandler = c.emitJump(OpTryFinally, span)
+		region.handlers++
+	}
+	if s.Catch != nil {
+		catchHandler = c.emitJump(OpTry, span)
+		region.handlers++
+	}
+
+	c.tries = append(c.tries, region)
+	c.statement(s.Body)
+	if s.Catch != nil {
+		c.emitOp(OpEndTry, span)
+		region.handlers--
+		skip := c.emitJump(OpJump, span)
+
+		// the VM pushes the caught value before jumping here.
+		c.patchJump(catchHandler, span)
+		c.beginScope()
+		c.addLocal(s.Name)
+		c.markInitialized()
+		c.hoist(s.Catch.Statements)
+		for _, stmt := range s.Catch.Statements {
+			c.statement(stmt)
+		}
+		c.endScope(s.Catch.Rbrace.Span())
+		c.patchJump(skip, span)
+	}
+	c.tries = c.tries[:len(c.tries)-1]
+
+	if s.Finally != nil {
+		c.emitOp(OpEndTry, span)
+		c.statement(s.Finally)
+		done := c.emitJump(OpJump, span)
+
+		// the VM pushes the error being raised before jumping here.
+		c.patchJump(finallyHandler, span)
+		c.beginScope()
+		c.addHidden(span)
+		c.statement(s.Finally)
+		c.emitOp(OpRethrow, span)
+		// nothing after OpRethrow runs, so the error is not popped.
+		c.locals = c.locals[:len(c.locals)-1]
+		c.scopeDepth--
+		c.patchJump(done, span)
+	}
+	return nil
+}
+
+func (c *compiler) VisitorStmtImport(s *ast.StmtImport[any]) any {
+	if !c.topLevel() {
+		c.error(s.Keyword, "Can only import at the top level.")
+		return nil
+	}
+	c.emitConstant(OpImport, s.Path.Literal, s.Path.Span())
+	c.defineVariable(s.Name)
+	return nil
+}
+
+func (c *compiler) VisitorStmtExport(s *ast.StmtExport[any]) any {
+	if !c.topLevel() {
+		c.error(s.Keyword, "Can only export at the top level.")
+		return nil
+	}
+	c.statement(s.Declaration)
+	var name token.Token
+	switch d := s.Declaration.(type) {
+	case *ast.StmtFunction[any]:
+		name = d.Name
+	case *ast.StmtClass[any]:
+		name = d.Name
+	case *ast.StmtVar[any]:
+		name = d.Name
+	}
+	c.function.Exports = append(c.function.Exports, name.Lexeme)
+	return nil
+}
+
+func (c *compiler) VisitorExprCall(e *ast.ExprCall[any]) any {
+	c.expression(e.Callee)
+	for _, arg := range e.Arguments {
+		c.expression(arg)
+	}
+	if len(e.Arguments) > 255 {
+		c.error(e.Param, "Can't have more than 255 arguments.")
+	}
+	// the call spans the whole expression, which is where traces point;
+	// errors of the call itself are reported at the closing parenthesis.
+	c.emit(e.Span(), byte(OpCall), byte(len(e.Arguments)))
+	return nil
+}
+
+func (c *compiler) VisitorExprBinary(e *ast.ExprBinary[any]) any {
+	c.expression(e.Left)
+	c.expression(e.Right)
+	span := e.Token.Span()
+	switch e.Token.Type {
+	case token.MINUS:
+		c.emitOp(OpSubtract, span)
+	case token.PLUS:
+		c.emitOp(OpAdd, span)
+	case token.SLASH:
+		c.emitOp(OpDivide, span)
+	case token.STAR:
+		c.emitOp(OpMultiply, span)
+	case token.GREATER:
+		c.emitOp(OpGreater, span)
+	case token.GREATER_EQUAL:
+		c.emitOp(OpGreaterEqual, span)
+	case token.LESS:
+		c.emitOp(OpLess, span)
+	case token.LESS_EQUAL:
+		c.emitOp(OpLessEqual, span)
+	case token.BANG_EQUAL:
+		c.emitOp(OpEqual, span)
+		c.emitOp(OpNot, span)
+	case token.EQUAL_EQUAL:
+		c.emitOp(OpEqual, span)
+	}
+	return nil
+}
+
+func (c *compiler) VisitorExprGrouping(e *ast.ExprGrouping[any]) any {
+	c.expression(e.Expression)
+	return nil
+}
+
+func (c *compiler) VisitorExprLiteral(e *ast.ExprLiteral[any]) any {
+	span := e.Token.Span()
+	switch e.Value {
+	case nil:
+		c.emitOp(OpNil, span)
+	case true:
+		c.emitOp(OpTrue, span)
+	case false:
+		c.emitOp(OpFalse, span)
+	default:
+		c.emitConstant(OpConstant, e.Value, span)
+	}
+	return nil
+}
+
+func (c *compiler) VisitorExprUnary(e *ast.ExprUnary[any]) any {
+	c.expression(e.Right)
+	switch e.Token.Type {
+	case token.MINUS:
+		c.emitOp(OpNegate, e.Token.Span())
+	case token.BANG:
+		c.emitOp(OpNot, e.Token.Span())
+	}
+	return nil
+}
+
+func (c *compiler) VisitorExprAssign(e *ast.ExprAssign[any]) any {
+	c.expression(e.Value)
+	c.setVariable(e.Name)
+	return nil
+}
+
+func (c *compiler) VisitorExprVariable(e *ast.ExprVariable[any]) any {
+	c.getVariable(e.Name)
+	return nil
+}
+
+func (c *compiler) VisitorExprLogical(e *ast.ExprLogical[any]) any {
+	span := e.Operator.Span()
+	c.expression(e.Left)
+	if e.Operator.Type == token.OR {
+		elseJump := c.emitJump(OpJumpIfFalse, span)
+		endJump := c.emitJump(OpJump, span)
+		c.patchJump(elseJump, span)
+		c.emitOp(OpPop, span)
+		c.expression(e.Right)
+		c.patchJump(endJump, span)
+		return nil
+	}
+	endJump := c.emitJump(OpJumpIfFalse, span)
+	c.emitOp(OpPop, span)
+	c.expression(e.Right)
+	c.patchJump(endJump, span)
+	return nil
+}
+
+func (c *compiler) VisitorExprGet(e *ast.ExprGet[any]) any {
+	c.expression(e.Object)
+	c.emitConstant(OpGetProperty, e.Name.Lexeme, e.Name.Span())
+	return nil
+}
+
+func (c *compiler) VisitorExprSet(e *ast.ExprSet[any]) any {
+	c.expression(e.Object)
+	c.expression(e.Value)
+	c.emitConstant(OpSetProperty, e.Name.Lexeme, e.Name.Span())
+	return nil
+}
+
+func (c *compiler) VisitorExprThis(e *ast.ExprThis[any]) any {
+	if c.class == nil {
+		c.error(e.Keyword, "Can't use 'this' outside of a class.")
+		return nil
+	}
+	c.getVariable(e.Keyword)
+	return nil
+}
+
+func (c *compiler) VisitorExprSuper(e *ast.ExprSuper[any]) any {
+	switch {
+	case c.class == nil:
+		c.error(e.Keyword, "Can't use 'super' outside of a class.")
+		return nil
+	case !c.class.hasSuperclass:
+		c.error(e.Keyword, "Can't use 'super' in a class with no superclass.")
+		return nil
+	}
+	c.getVariable(token.Token{Lexeme: "this", Line: e.Keyword.Line, Column: e.Keyword.Column, Offset: e.Keyword.Offset, End: e.Keyword.End})
+	c.getVariable(e.Keyword)
+	c.emitConstant(OpGetSuper, e.Method.Lexeme, e.Method.Span())
+	return nil
+}
+
+func (c *compiler) VisitorExprList(e *ast.ExprList[any]) any {
+	for _, element := range e.Elements {
+		c.expression(element)
+	}
+	c.emit(e.Span(), byte(OpList), byte(len(e.Elements)>>8), byte(len(e.Elements)))
+	return nil
+}
+
+func (c *compiler) VisitorExprIndex(e *ast.ExprIndex[any]) any {
+	c.expression(e.Object)
+	c.expression(e.Index)
+	c.emitOp(OpGetIndex, e.Rbracket.Span())
+	return nil
+}
+
+func (c *compiler) VisitorExprIndexSet(e *ast.ExprIndexSet[any]) any {
+	c.expression(e.Object)
+	c.expression(e.Index)
+	c.expression(e.Value)
+	c.emitOp(OpSetIndex, e.Rbracket.Span())
+	return nil
+}
+
+func (c *compiler) VisitorExprMap(e *ast.ExprMap[any]) any {
+	for i, key := range e.Keys {
+		c.expression(key)
+		c.expression(e.Values[i])
+	}
+	c.emit(e.Lbrace.Span(), byte(OpMap), byte(len(e.Keys)>>8), byte(len(e.Keys)))
+	return nil
+}
+
+func (c *compiler) VisitorExprFunction(e *ast.ExprFunction[any]) any {
+	c.compileFunction(kindFunction, lambdaName, e.Params, e.Body, e.Keyword.Span())
+	return nil
+}
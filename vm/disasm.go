@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cndoit18/lox/builtin"
+)
+
+// Disassemble writes the bytecode of function and of the functions it
+// declares, one instruction per line: the offset, the source line (or |
+// when it is the same as the previous instruction's), the opcode and its
+// operands, with constants shown by value.
+func Disassemble(w io.Writer, function *Function) {
+	fmt.Fprintf(w, "== %s ==\n", function)
+	chunk := &function.Chunk
+	for offset := 0; offset < len(chunk.Code); {
+		offset = disassembleInstruction(w, chunk, offset)
+	}
+	for _, constant := range chunk.Constants {
+		if nested, ok := constant.(*Function); ok {
+			fmt.Fprintln(w)
+			Disassemble(w, nested)
+		}
+	}
+}
+
+func disassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	line := chunk.Spans[offset].Start.Line
+	if offset > 0 && line == chunk.Spans[offset-1].Start.Line {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", line)
+	}
+
+	op := OpCode(chunk.Code[offset])
+	short := func(at int) int {
+		return int(chunk.Code[at])<<8 | int(chunk.Code[at+1])
+	}
+	switch op {
+	case OpConstant, OpGetGlobal, OpDefineGlobal, OpSetGlobal, OpGetProperty, OpSetProperty,
+		OpGetSuper, OpClass, OpMethod, OpImport:
+		// names are strings too, but only constants are quoted as such.
+		index := short(offset + 1)
+		value := fmt.Sprint(chunk.Constants[index])
+		if op == OpConstant {
+			value = builtin.Quote(chunk.Constants[index])
+		}
+		fmt.Fprintf(w, "%-16s %4d '%s'\n", op, index, value)
+		return offset + 3
+	case OpGetLocal, OpSetLocal, OpGetUpvalue, OpSetUpvalue, OpCall:
+		fmt.Fprintf(w, "%-16s %4d\n", op, chunk.Code[offset+1])
+		return offset + 2
+	case OpList, OpMap:
+		fmt.Fprintf(w, "%-16s %4d\n", op, short(offset+1))
+		return offset + 3
+	case OpJump, OpJumpIfFalse, OpJumpIfDeclared, OpTry, OpTryFinally, OpForIter:
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3+short(offset+1))
+		return offset + 3
+	case OpLoop:
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3-short(offset+1))
+		return offset + 3
+	case OpClosure:
+		index := short(offset + 1)
+		function := chunk.Constants[index].(*Function)
+		fmt.Fprintf(w, "%-16s %4d %s\n", op, index, function)
+		offset += 3
+		for i := 0; i < function.Upvalues; i++ {
+			kind := "upvalue"
+			if chunk.Code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.Code[offset+1])
+			offset += 2
+		}
+		return offset
+	}
+	fmt.Fprintln(w, op)
+	return offset + 1
+}
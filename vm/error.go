@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"github.com/cndoit18/lox/diagnostic"
+	"github.com/cndoit18/lox/token"
+)
+
+// compileError reports code that parses but can't be compiled, such as a
+// return statement outside of a function.
+type compileError struct {
+	span token.Span
+	msg  string
+}
+
+func (c *compileError) Error() string {
+	return c.Diagnostic().String()
+}
+
+func (c *compileError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     c.span,
+		Message:  c.msg,
+	}
+}
+
+type runtimeError struct {
+	span  token.Span
+	msg   string
+	trace diagnostic.Trace
+	// notes are shown before the trace.
+	notes []string
+	// value is set when the error was raised by a throw statement.
+	value  any
+	thrown bool
+	// cause is set when the script was interrupted. Such errors can't be
+	// caught, and finally blocks don't run for them.
+	cause error
+}
+
+// Unwrap returns the reason the script was interrupted, if it was.
+func (r *runtimeError) Unwrap() error {
+	return r.cause
+}
+
+// caught returns the value bound by a catch clause: either the thrown value
+// or an Error instance describing the runtime error.
+func (r *runtimeError) caught() any {
+	if r.thrown {
+		return r.value
+	}
+	return &instance{
+		class: errorClass,
+		fields: map[string]any{
+			"message": r.msg,
+			"line":    float64(r.span.Start.Line),
+		},
+	}
+}
+
+// Trace returns the stack of calls that were active when the error was raised.
+func (r *runtimeError) Trace() diagnostic.Trace {
+	return r.trace
+}
+
+func (r *runtimeError) Error() string {
+	return r.Diagnostic().String()
+}
+
+func (r *runtimeError) Diagnostic() diagnostic.Diagnostic {
+	return diagnostic.Diagnostic{
+		Severity: diagnostic.Error,
+		Span:     r.span,
+		Message:  r.msg,
+		Notes:    append(append([]string{}, r.notes...), r.trace.Notes()...),
+	}
+}
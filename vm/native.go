@@ -0,0 +1,45 @@
+package vm
+
+import "github.com/cndoit18/lox/builtin"
+
+// NewNative wraps a Go function so that it can be called from scripts.
+func NewNative(name string, arity int, fn NativeFunc) any {
+	return &native{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+// Define binds a value to a global name visible to the main script and
+// every module.
+func (vm *VM) Define(name string, value any) {
+	vm.builtins[name] = value
+}
+
+// DefineNative registers a Go function as a global function.
+func (vm *VM) DefineNative(name string, arity int, fn NativeFunc) {
+	vm.Define(name, NewNative(name, arity, fn))
+}
+
+// engine shows the values of the VM to the standard natives.
+var engine = builtin.Engine{TypeOf: typeOf, Equal: isEqual}
+
+func defineStandard(vm *VM) {
+	engine.Define(vm.DefineNative, vm.stdin)
+}
+
+// typeOf names the types of the values the VM adds to the builtin ones.
+func typeOf(value any) string {
+	switch value.(type) {
+	case *class:
+		return "class"
+	case *instance:
+		return "instance"
+	case *module:
+		return "module"
+	case *closure, *boundMethod, *native:
+		return "function"
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package vm
+
+import (
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/token"
+)
+
+// Function is a compiled function, shared by every closure created from it.
+type Function struct {
+	// Name is empty for the top-level code of a script or module.
+	Name     string
+	Arity    int
+	Upvalues int
+	Chunk    Chunk
+	// Exports lists the names exported by a module script.
+	Exports []string
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<script>"
+	}
+	return "<fn " + f.Name + ">"
+}
+
+type closure struct {
+	function *Function
+	upvalues []*upvalue
+	// module holds the globals the function reads and writes.
+	module *module
+}
+
+func (c *closure) String() string {
+	return c.function.String()
+}
+
+// upvalue is a variable captured by a closure. It refers to a stack slot
+// until the variable goes out of scope, when the value is moved into
+// closed.
+type upvalue struct {
+	slot   int
+	open   bool
+	closed any
+	// next is the open upvalue for the next lower slot.
+	next *upvalue
+}
+
+// hole fills the slot of a function declared further down its block until
+// the declaration runs.
+type hole struct{}
+
+type class struct {
+	name string
+	// methods includes those inherited from the superclass, which are
+	// copied in before the class's own methods are defined.
+	methods map[string]*closure
+}
+
+func (c *class) String() string {
+	return c.name
+}
+
+// errorClass is the class of the values a catch clause binds for runtime
+// errors.
+var errorClass = &class{name: "Error", methods: map[string]*closure{}}
+
+type instance struct {
+	class  *class
+	fields map[string]any
+}
+
+func (i *instance) String() string {
+	return i.class.name + " instance"
+}
+
+func (i *instance) ClassName() string {
+	return i.class.name
+}
+
+func (i *instance) Field(name string) (any, bool) {
+	value, ok := i.fields[name]
+	return value, ok
+}
+
+type boundMethod struct {
+	receiver any
+	method   *closure
+}
+
+func (b *boundMethod) String() string {
+	return b.method.String()
+}
+
+// Variadic is the arity of a native function that accepts any number of arguments.
+const Variadic = builtin.Variadic
+
+// NativeFunc is the Go implementation of a native function. A non-nil error
+// is reported to the script as a runtime error at the call site.
+type NativeFunc = builtin.Func
+
+type native struct {
+	name  string
+	arity int
+	fn    NativeFunc
+}
+
+func (n *native) String() string {
+	return "<native fn " + n.name + ">"
+}
+
+// module is an imported file, or the main script.
+type module struct {
+	// name is the path the module was first imported as.
+	name    string
+	file    string
+	globals map[string]any
+	exports map[string]bool
+	// loading is set while the module body runs, to detect import cycles.
+	loading bool
+}
+
+func (m *module) String() string {
+	return "<module " + m.name + ">"
+}
+
+// iterator is the hidden loop state of a for-in statement.
+type iterator struct {
+	keyword token.Token
+	// next is set for built-in sequences.
+	next func() (any, bool)
+	// hasNext and advance are set for objects implementing the protocol.
+	hasNext, advance any
+}
+
+func isTruthy(value any) bool {
+	if value == nil {
+		return false
+	}
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return true
+}
+
+func isEqual(a, b any) bool {
+	// a method is bound anew every time it is read.
+	if x, ok := a.(*boundMethod); ok {
+		y, ok := b.(*boundMethod)
+		return ok && x.method == y.method && isEqual(x.receiver, y.receiver)
+	}
+	return a == b
+}
@@ -0,0 +1,974 @@
+package vm
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/builtin"
+	"github.com/cndoit18/lox/diagnostic"
+	"github.com/cndoit18/lox/limit"
+	"github.com/cndoit18/lox/token"
+)
+
+type callFrame struct {
+	closure *closure
+	// ip is the offset of the next instruction in the code of closure.
+	ip int
+	// base is the stack slot of the callee, slot 0 of the function.
+	base int
+	// name is what traces call the function; initializers run by calling
+	// their class are named after it.
+	name string
+}
+
+// position returns where execution is in the frame: the start of the
+// instruction being executed.
+func (f *callFrame) position() token.Position {
+	return f.closure.function.Chunk.Spans[f.ip-1].Start
+}
+
+// handler is an installed catch clause or finally block.
+type handler struct {
+	// ip is the offset of the handler code in the frame's function.
+	ip    int
+	frame int
+	// stack is the stack height to unwind to.
+	stack   int
+	finally bool
+}
+
+// VM executes compiled scripts on a stack. It is not safe for concurrent
+// use.
+type VM struct {
+	stack    []any
+	frames   []callFrame
+	handlers []handler
+	// openUpvalues is the list of upvalues still pointing to the stack,
+	// highest slot first.
+	openUpvalues *upvalue
+
+	// builtins holds the natives shared by the main script and every
+	// module.
+	builtins map[string]any
+	main     *module
+	loader   ast.Loader
+	modules  map[string]*module
+	// importing is the stack of modules whose bodies are running.
+	importing []*module
+
+	stdout io.Writer
+	stdin  *bufio.Reader
+
+	// budget is the number of steps each run may take, or zero for no
+	// limit.
+	budget int
+	// memory is the number of bytes each run may allocate, or zero for no
+	// limit.
+	memory int
+	meter  limit.Meter
+	// maxDepth is the number of calls that can be nested.
+	maxDepth int
+}
+
+type Option func(*VM)
+
+// WithStdout sets the writer used by print statements. Defaults to os.Stdout.
+func WithStdout(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.stdout = w
+	}
+}
+
+// WithStdin sets the reader used by the input native. Defaults to os.Stdin.
+func WithStdin(r io.Reader) Option {
+	return func(vm *VM) {
+		vm.stdin = bufio.NewReader(r)
+	}
+}
+
+// WithLoader enables import statements, using l to find modules.
+func WithLoader(l ast.Loader) Option {
+	return func(vm *VM) {
+		vm.loader = l
+	}
+}
+
+// WithBudget limits each run to steps loop iterations and calls. A run
+// that goes over fails with an error wrapping limit.ErrBudgetExceeded.
+func WithBudget(steps int) Option {
+	return func(vm *VM) {
+		vm.budget = steps
+	}
+}
+
+// WithMemoryLimit limits each run to allocating about bytes bytes. A run
+// that goes over fails with an error wrapping limit.ErrMemoryExceeded.
+func WithMemoryLimit(bytes int) Option {
+	return func(vm *VM) {
+		vm.memory = bytes
+	}
+}
+
+// WithMaxDepth sets the number of calls that can be nested before a call
+// fails with a stack overflow. Defaults to limit.DefaultMaxDepth.
+func WithMaxDepth(depth int) Option {
+	return func(vm *VM) {
+		vm.maxDepth = depth
+	}
+}
+
+func New(opts ...Option) *VM {
+	vm := &VM{
+		builtins: map[string]any{},
+		main:     &module{globals: map[string]any{}},
+		modules:  map[string]*module{},
+		maxDepth: limit.DefaultMaxDepth,
+		stdout:   os.Stdout,
+		stdin:    bufio.NewReader(os.Stdin),
+	}
+	for _, opt := range opts {
+		opt(vm)
+	}
+	defineStandard(vm)
+	return vm
+}
+
+// Run compiles and executes stmts. Globals defined by earlier runs remain
+// visible. It returns the value of the last statement when that is an
+// expression statement.
+func (vm *VM) Run(stmts []ast.Stmt[any]) (any, error) {
+	return vm.RunContext(context.Background(), stmts)
+}
+
+// RunContext is like Run, stopping the script with an error wrapping the
+// error of ctx once ctx is done. Loops and calls check ctx, so natives that
+// block are not interrupted.
+func (vm *VM) RunContext(ctx context.Context, stmts []ast.Stmt[any]) (any, error) {
+	function, err := Compile(stmts)
+	if err != nil {
+		return nil, err
+	}
+	vm.meter = limit.NewMeter(ctx, vm.budget, vm.memory)
+	script := &closure{function: function, module: vm.main}
+	vm.push(script)
+	vm.frames = append(vm.frames, callFrame{closure: script})
+	if err := vm.run(0); err != nil {
+		vm.reset()
+		return nil, err
+	}
+	return vm.pop(), nil
+}
+
+// Allocated returns the approximate number of bytes allocated by the last
+// run.
+func (vm *VM) Allocated() int {
+	return vm.meter.Allocated()
+}
+
+// reset empties the stacks after an error, so the next run starts clean.
+func (vm *VM) reset() {
+	vm.stack = vm.stack[:0]
+	vm.frames = vm.frames[:0]
+	vm.handlers = vm.handlers[:0]
+	vm.openUpvalues = nil
+	vm.importing = vm.importing[:0]
+}
+
+func (vm *VM) push(value any) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() any {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) any {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+// run executes instructions until the frame at index base returns.
+// Errors are handled by the catch clauses and finally blocks of frames
+// from base up, and returned when there are none.
+func (vm *VM) run(base int) error {
+	for {
+		frame := &vm.frames[len(vm.frames)-1]
+		chunk := &frame.closure.function.Chunk
+		span := chunk.Spans[frame.ip]
+		op := OpCode(chunk.Code[frame.ip])
+		frame.ip++
+
+		var err error
+		switch op {
+		case OpConstant:
+			vm.push(chunk.Constants[vm.readShort(frame)])
+		case OpNil:
+			vm.push(nil)
+		case OpHole:
+			vm.push(hole{})
+		case OpTrue:
+			vm.push(true)
+		case OpFalse:
+			vm.push(false)
+		case OpPop:
+			vm.pop()
+		case OpGetLocal:
+			vm.push(vm.stack[frame.base+vm.readByte(frame)])
+		case OpSetLocal:
+			vm.stack[frame.base+vm.readByte(frame)] = vm.peek(0)
+		case OpGetGlobal:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			value, ok := frame.closure.module.globals[name]
+			if !ok {
+				value, ok = vm.builtins[name]
+			}
+			if !ok {
+				err = vm.newError(span, "Undefined variable '"+name+"'.")
+				break
+			}
+			vm.push(value)
+		case OpDefineGlobal:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			frame.closure.module.globals[name] = vm.pop()
+			err = vm.alloc(span, limit.SlotSize)
+		case OpSetGlobal:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			if _, ok := frame.closure.module.globals[name]; ok {
+				frame.closure.module.globals[name] = vm.peek(0)
+			} else if _, ok := vm.builtins[name]; ok {
+				vm.builtins[name] = vm.peek(0)
+			} else {
+				err = vm.newError(span, "Undefined variable '"+name+"'.")
+			}
+		case OpGetUpvalue:
+			upvalue := frame.closure.upvalues[vm.readByte(frame)]
+			if upvalue.open {
+				vm.push(vm.stack[upvalue.slot])
+			} else {
+				vm.push(upvalue.closed)
+			}
+		case OpSetUpvalue:
+			upvalue := frame.closure.upvalues[vm.readByte(frame)]
+			if upvalue.open {
+				vm.stack[upvalue.slot] = vm.peek(0)
+			} else {
+				upvalue.closed = vm.peek(0)
+			}
+		case OpGetProperty:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			var value any
+			value, err = vm.getProperty(span, vm.peek(0), name)
+			if err == nil {
+				vm.stack[len(vm.stack)-1] = value
+			}
+		case OpSetProperty:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			instance, ok := vm.peek(1).(*instance)
+			if !ok {
+				err = vm.newError(span, "Only instances have fields.")
+				break
+			}
+			value := vm.pop()
+			if _, ok := instance.fields[name]; !ok {
+				err = vm.alloc(span, 2*limit.SlotSize)
+			}
+			instance.fields[name] = value
+			vm.stack[len(vm.stack)-1] = value
+		case OpGetSuper:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			superclass := vm.pop().(*class)
+			method, ok := superclass.methods[name]
+			if !ok {
+				err = vm.newError(span, "Undefined property '"+name+"'.")
+				break
+			}
+			vm.stack[len(vm.stack)-1] = &boundMethod{receiver: vm.peek(0), method: method}
+		case OpGetIndex:
+			index := vm.pop()
+			var value any
+			value, err = vm.getIndex(span, vm.peek(0), index)
+			if err == nil {
+				vm.stack[len(vm.stack)-1] = value
+			}
+		case OpSetIndex:
+			value, index := vm.pop(), vm.pop()
+			err = vm.setIndex(span, vm.peek(0), index, value)
+			if err == nil {
+				vm.stack[len(vm.stack)-1] = value
+			}
+		case OpEqual:
+			b := vm.pop()
+			vm.stack[len(vm.stack)-1] = isEqual(vm.peek(0), b)
+		case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpSubtract, OpMultiply, OpDivide:
+			a, ok1 := vm.peek(1).(float64)
+			b, ok2 := vm.peek(0).(float64)
+			if !ok1 || !ok2 {
+				err = vm.newError(span, "Operands must be numbers.")
+				break
+			}
+			vm.pop()
+			vm.stack[len(vm.stack)-1] = arithmetic(op, a, b)
+		case OpAdd:
+			switch a := vm.peek(1).(type) {
+			case string:
+				s := a + fmt.Sprint(vm.pop())
+				vm.stack[len(vm.stack)-1] = s
+				err = vm.alloc(span, len(s))
+			case float64:
+				b, ok := vm.peek(0).(float64)
+				if !ok {
+					err = vm.newError(span, "Operands must be numbers.")
+					break
+				}
+				vm.pop()
+				vm.stack[len(vm.stack)-1] = a + b
+			default:
+				err = vm.newError(span, "Operands must be numbers.")
+			}
+		case OpNot:
+			vm.stack[len(vm.stack)-1] = !isTruthy(vm.peek(0))
+		case OpNegate:
+			n, ok := vm.peek(0).(float64)
+			if !ok {
+				err = vm.newError(span, "Operands must be numbers.")
+				break
+			}
+			vm.stack[len(vm.stack)-1] = -n
+		case OpPrint:
+			fmt.Fprint(vm.stdout, vm.pop())
+		case OpJump:
+			offset := vm.readShort(frame)
+			frame.ip += offset
+		case OpJumpIfFalse:
+			offset := vm.readShort(frame)
+			if !isTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case OpJumpIfDeclared:
+			offset := vm.readShort(frame)
+			if _, ok := vm.peek(0).(hole); ok {
+				vm.pop()
+			} else {
+				frame.ip += offset
+			}
+		case OpLoop:
+			offset := vm.readShort(frame)
+			frame.ip -= offset
+			err = vm.step(span)
+		case OpCall:
+			argc := vm.readByte(frame)
+			if err = vm.step(paren(span)); err == nil {
+				err = vm.call(vm.peek(argc), argc, span)
+			}
+		case OpClosure:
+			function := chunk.Constants[vm.readShort(frame)].(*Function)
+			c := &closure{
+				function: function,
+				upvalues: make([]*upvalue, function.Upvalues),
+				module:   frame.closure.module,
+			}
+			for i := range c.upvalues {
+				isLocal, index := vm.readByte(frame), vm.readByte(frame)
+				if isLocal == 1 {
+					c.upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					c.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			// the variables c captures are charged for with it, as a whole
+			// environment is by the evaluator.
+			vm.push(c)
+			err = vm.alloc(span, limit.ObjectSize)
+		case OpCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.pop()
+		case OpReturn:
+			result := vm.pop()
+			vm.closeUpvalues(frame.base)
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			for len(vm.handlers) > 0 && vm.handlers[len(vm.handlers)-1].frame >= len(vm.frames) {
+				vm.handlers = vm.handlers[:len(vm.handlers)-1]
+			}
+			vm.push(result)
+			if len(vm.frames) == base {
+				return nil
+			}
+		case OpClass:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			vm.push(&class{name: name, methods: map[string]*closure{}})
+			err = vm.alloc(span, limit.ObjectSize)
+		case OpInherit:
+			superclass, ok := vm.peek(1).(*class)
+			if !ok {
+				err = vm.newError(span, "Superclass must be a class.")
+				break
+			}
+			subclass := vm.pop().(*class)
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+		case OpMethod:
+			name := chunk.Constants[vm.readShort(frame)].(string)
+			method := vm.pop().(*closure)
+			vm.peek(0).(*class).methods[name] = method
+		case OpList:
+			n := vm.readShort(frame)
+			elements := append([]any{}, vm.stack[len(vm.stack)-n:]...)
+			vm.stack = vm.stack[:len(vm.stack)-n]
+			vm.push(&builtin.List{Elements: elements})
+			err = vm.alloc(span, limit.ObjectSize+limit.SlotSize*n)
+		case OpMap:
+			n := vm.readShort(frame)
+			pairs := vm.stack[len(vm.stack)-2*n:]
+			d := builtin.NewMap()
+			for i := 0; i < len(pairs); i += 2 {
+				if !builtin.IsKey(pairs[i]) {
+					err = vm.newError(span, "Map keys must be strings or numbers.")
+					break
+				}
+				d.Put(pairs[i], pairs[i+1])
+			}
+			if err == nil {
+				vm.stack = vm.stack[:len(vm.stack)-2*n]
+				vm.push(d)
+				err = vm.alloc(span, builtin.Footprint(d))
+			}
+		case OpThrow:
+			value := vm.pop()
+			err = &runtimeError{
+				span:   span,
+				msg:    builtin.Uncaught(value),
+				trace:  vm.traceback(span.Start, nil),
+				value:  value,
+				thrown: true,
+			}
+		case OpTry, OpTryFinally:
+			offset := vm.readShort(frame)
+			vm.handlers = append(vm.handlers, handler{
+				ip:      frame.ip + offset,
+				frame:   len(vm.frames) - 1,
+				stack:   len(vm.stack),
+				finally: op == OpTryFinally,
+			})
+		case OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case OpRethrow:
+			err = vm.pop().(*runtimeError)
+		case OpIter:
+			var it *iterator
+			it, err = vm.iterate(span, vm.peek(0))
+			if err == nil {
+				vm.stack[len(vm.stack)-1] = it
+			}
+		case OpForIter:
+			offset := vm.readShort(frame)
+			var value any
+			var ok bool
+			value, ok, err = vm.next(span, vm.peek(0).(*iterator))
+			if err != nil {
+				break
+			}
+			if !ok {
+				// the frame may have moved if the iterator called back
+				// into scripts.
+				vm.frames[len(vm.frames)-1].ip += offset
+				break
+			}
+			vm.push(value)
+		case OpImport:
+			path := chunk.Constants[vm.readShort(frame)].(string)
+			var m *module
+			m, err = vm.importModule(span, path, frame.closure.module)
+			if err == nil {
+				vm.push(m)
+			}
+		default:
+			panic(fmt.Sprintf("unknown opcode %d", op))
+		}
+
+		if err != nil && !vm.catch(err, base) {
+			return err
+		}
+	}
+}
+
+func (vm *VM) readByte(frame *callFrame) int {
+	b := frame.closure.function.Chunk.Code[frame.ip]
+	frame.ip++
+	return int(b)
+}
+
+func (vm *VM) readShort(frame *callFrame) int {
+	code := frame.closure.function.Chunk.Code
+	frame.ip += 2
+	return int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+}
+
+func arithmetic(op OpCode, a, b float64) any {
+	switch op {
+	case OpGreater:
+		return a > b
+	case OpGreaterEqual:
+		return a >= b
+	case OpLess:
+		return a < b
+	case OpLessEqual:
+		return a <= b
+	case OpSubtract:
+		return a - b
+	case OpMultiply:
+		return a * b
+	}
+	return a / b
+}
+
+// catch unwinds to the innermost handler installed by a frame from base
+// up, reporting false when there is none.
+func (vm *VM) catch(err error, base int) bool {
+	r, ok := err.(*runtimeError)
+	if !ok || r.cause != nil || len(vm.handlers) == 0 {
+		return false
+	}
+	h := vm.handlers[len(vm.handlers)-1]
+	if h.frame < base {
+		return false
+	}
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.closeUpvalues(h.stack)
+	vm.stack = vm.stack[:h.stack]
+	vm.frames = vm.frames[:h.frame+1]
+	vm.frames[h.frame].ip = h.ip
+	if h.finally {
+		vm.push(r)
+	} else {
+		vm.push(r.caught())
+	}
+	return true
+}
+
+// step counts a loop iteration or call made at span, and returns the error
+// stopping the script when the limits of the run are reached.
+func (vm *VM) step(span token.Span) error {
+	if cause := vm.meter.Step(); cause != nil {
+		return vm.interrupt(span, cause)
+	}
+	return nil
+}
+
+// alloc charges size bytes allocated at span, and returns the error
+// stopping the script when the run goes over its memory limit.
+func (vm *VM) alloc(span token.Span, size int) error {
+	if cause := vm.meter.Alloc(size); cause != nil {
+		return vm.interrupt(span, cause)
+	}
+	return nil
+}
+
+// interrupt returns the error stopping the script at span because of
+// cause, returned by the meter.
+func (vm *VM) interrupt(span token.Span, cause error) error {
+	err := vm.newError(span, limit.Message(cause))
+	err.cause = cause
+	return err
+}
+
+// newError returns a runtime error raised at span, traced from the
+// current frame.
+func (vm *VM) newError(span token.Span, msg string) *runtimeError {
+	return &runtimeError{
+		span:  span,
+		msg:   msg,
+		trace: vm.traceback(span.Start, nil),
+	}
+}
+
+// traceback snapshots the call stack for an error raised at at, after the
+// frames already in trace. Frames stop at the script or module running
+// the calls.
+func (vm *VM) traceback(at token.Position, trace diagnostic.Trace) diagnostic.Trace {
+	for n := len(vm.frames) - 1; n > 0 && vm.frames[n].closure.function.Name != ""; n-- {
+		trace = append(trace, diagnostic.Frame{Function: vm.frames[n].name, Pos: at})
+		at = vm.frames[n-1].position()
+	}
+	if len(trace) == 0 {
+		return nil
+	}
+	return append(trace, diagnostic.Frame{Pos: at})
+}
+
+// paren returns the closing parenthesis of the call at span, where
+// errors of the call itself are reported.
+func paren(span token.Span) token.Span {
+	start := span.End
+	start.Offset--
+	start.Column--
+	return token.Span{Start: start, End: span.End}
+}
+
+// call calls callee with the argc arguments on top of the stack. Functions
+// get a new frame; natives and classes without an initializer leave their
+// result in place of the callee.
+func (vm *VM) call(callee any, argc int, span token.Span) error {
+	switch callee := callee.(type) {
+	case *closure:
+		return vm.callClosure(callee, argc, span, callee.function.Name)
+	case *boundMethod:
+		vm.stack[len(vm.stack)-argc-1] = callee.receiver
+		return vm.callClosure(callee.method, argc, span, callee.method.function.Name)
+	case *class:
+		initializer, ok := callee.methods["init"]
+		arity := 0
+		if ok {
+			arity = initializer.function.Arity
+		}
+		// the arguments are checked before the instance is created, as in
+		// the evaluator.
+		if argc != arity {
+			return vm.arityError(span, arity, argc)
+		}
+		vm.stack[len(vm.stack)-argc-1] = &instance{class: callee, fields: map[string]any{}}
+		if err := vm.alloc(paren(span), limit.ObjectSize); err != nil {
+			return err
+		}
+		if ok {
+			return vm.callClosure(initializer, argc, span, callee.name)
+		}
+		return nil
+	case *native:
+		if callee.arity != Variadic && argc != callee.arity {
+			return vm.arityError(span, callee.arity, argc)
+		}
+		args := append([]any{}, vm.stack[len(vm.stack)-argc:]...)
+		before := builtin.Footprint(args...)
+		value, err := callee.fn(args...)
+		if err != nil {
+			at := paren(span)
+			return &runtimeError{
+				span:  at,
+				msg:   err.Error(),
+				trace: vm.traceback(span.Start, diagnostic.Trace{{Function: callee.name, Pos: at.Start}}),
+			}
+		}
+		if size := builtin.Allocated(before, value, args); size > 0 {
+			if err := vm.alloc(paren(span), size); err != nil {
+				return err
+			}
+		}
+		vm.stack = vm.stack[:len(vm.stack)-argc]
+		vm.stack[len(vm.stack)-1] = value
+		return nil
+	}
+	return vm.newError(paren(span), "Can only call functions and classes.")
+}
+
+func (vm *VM) callClosure(c *closure, argc int, span token.Span, name string) error {
+	if argc != c.function.Arity {
+		return vm.arityError(span, c.function.Arity, argc)
+	}
+	// the first frame is the script's, which is not a call.
+	if len(vm.frames) > vm.maxDepth {
+		return vm.newError(paren(span), "Stack overflow.")
+	}
+	vm.frames = append(vm.frames, callFrame{
+		closure: c,
+		base:    len(vm.stack) - argc - 1,
+		name:    name,
+	})
+	return nil
+}
+
+func (vm *VM) arityError(span token.Span, arity, argc int) error {
+	return vm.newError(paren(span), fmt.Sprint("Expected ", arity, " arguments but got ", argc, "."))
+}
+
+// invoke calls callee, already on the stack with its argc arguments, from
+// Go code and runs it to completion.
+func (vm *VM) invoke(callee any, argc int, span token.Span) (any, error) {
+	frames := len(vm.frames)
+	if err := vm.call(callee, argc, span); err != nil {
+		return nil, err
+	}
+	if len(vm.frames) > frames {
+		if err := vm.run(frames); err != nil {
+			return nil, err
+		}
+	}
+	return vm.pop(), nil
+}
+
+func (vm *VM) captureUpvalue(slot int) *upvalue {
+	var prev *upvalue
+	current := vm.openUpvalues
+	for current != nil && current.slot > slot {
+		prev, current = current, current.next
+	}
+	if current != nil && current.slot == slot {
+		return current
+	}
+	created := &upvalue{slot: slot, open: true, next: current}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves the variables in slots from last up off the stack.
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.open = false
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+func (vm *VM) getProperty(span token.Span, object any, name string) (any, error) {
+	switch object := object.(type) {
+	case *instance:
+		if value, ok := object.fields[name]; ok {
+			return value, nil
+		}
+		if method, ok := object.class.methods[name]; ok {
+			return &boundMethod{receiver: object, method: method}, nil
+		}
+		return nil, vm.newError(span, "Undefined property '"+name+"'.")
+	case *module:
+		if !object.exports[name] {
+			return nil, vm.newError(span, fmt.Sprintf("Module %s has no export '%s'.", builtin.Quote(object.name), name))
+		}
+		return object.globals[name], nil
+	}
+	return nil, vm.newError(span, "Only instances have properties.")
+}
+
+func (vm *VM) getIndex(span token.Span, object, index any) (any, error) {
+	var value any
+	var err error
+	switch object := object.(type) {
+	case *builtin.List:
+		value, err = object.Get(index)
+	case *builtin.Map:
+		value, err = object.Get(index)
+	default:
+		return nil, vm.newError(span, "Only lists and maps can be indexed.")
+	}
+	if err != nil {
+		return nil, vm.newError(span, err.Error())
+	}
+	return value, nil
+}
+
+func (vm *VM) setIndex(span token.Span, object, index, value any) error {
+	container, ok := object.(interface {
+		Set(any, any) error
+	})
+	if !ok {
+		return vm.newError(span, "Only lists and maps can be indexed.")
+	}
+	before := builtin.Footprint(object)
+	if err := container.Set(index, value); err != nil {
+		return vm.newError(span, err.Error())
+	}
+	return vm.alloc(span, builtin.Footprint(object)-before)
+}
+
+// iterate returns the iterator a for-in statement at span uses for value.
+func (vm *VM) iterate(span token.Span, value any) (*iterator, error) {
+	if next, ok := builtin.Iterate(value); ok {
+		return &iterator{next: next}, nil
+	}
+	if v, ok := value.(*instance); ok {
+		if it, ok := protocol(v); ok {
+			return it, nil
+		}
+		if method, ok := method(v, "iterator"); ok {
+			result, err := vm.invokeMethod(span, method)
+			if err != nil {
+				return nil, err
+			}
+			if object, ok := result.(*instance); ok {
+				if it, ok := protocol(object); ok {
+					return it, nil
+				}
+			}
+			return nil, vm.newError(span, "iterator() must return an object with hasNext() and next() methods.")
+		}
+	}
+	return nil, vm.newError(span, fmt.Sprintf("Can't iterate over %s.", engine.Describe(value)))
+}
+
+// next advances it, reporting false once it is exhausted.
+func (vm *VM) next(span token.Span, it *iterator) (any, bool, error) {
+	if it.next != nil {
+		value, ok := it.next()
+		return value, ok, nil
+	}
+	more, err := vm.invokeMethod(span, it.hasNext)
+	if err != nil || !isTruthy(more) {
+		return nil, false, err
+	}
+	value, err := vm.invokeMethod(span, it.advance)
+	return value, err == nil, err
+}
+
+// invokeMethod calls a protocol method that takes no arguments on behalf
+// of the for statement at span.
+func (vm *VM) invokeMethod(span token.Span, callee any) (any, error) {
+	name, arity := "", 0
+	switch callee := callee.(type) {
+	case *closure:
+		name, arity = callee.function.Name, callee.function.Arity
+	case *boundMethod:
+		name, arity = callee.method.function.Name, callee.method.function.Arity
+	case *native:
+		name, arity = callee.name, callee.arity
+	case *class:
+		name = callee.name
+		if initializer, ok := callee.methods["init"]; ok {
+			arity = initializer.function.Arity
+		}
+	}
+	if arity != 0 && arity != Variadic {
+		return nil, vm.newError(span, fmt.Sprintf("%s() must take no arguments.", name))
+	}
+	vm.push(callee)
+	return vm.invoke(callee, 0, token.Span{Start: span.Start, End: span.End})
+}
+
+// protocol looks up the hasNext and next methods of an iterator object.
+func protocol(object *instance) (*iterator, bool) {
+	hasNext, ok := method(object, "hasNext")
+	if !ok {
+		return nil, false
+	}
+	next, ok := method(object, "next")
+	if !ok {
+		return nil, false
+	}
+	return &iterator{hasNext: hasNext, advance: next}, true
+}
+
+// method returns the callable stored in field name, or the method of that
+// name bound to object.
+func method(object *instance, name string) (any, bool) {
+	if value, ok := object.fields[name]; ok {
+		return value, isCallable(value)
+	}
+	if method, ok := object.class.methods[name]; ok {
+		return &boundMethod{receiver: object, method: method}, true
+	}
+	return nil, false
+}
+
+func isCallable(value any) bool {
+	switch value.(type) {
+	case *closure, *boundMethod, *native, *class:
+		return true
+	}
+	return false
+}
+
+// importModule returns the module imported as path, running it first if
+// this is the first time it is imported.
+func (vm *VM) importModule(span token.Span, path string, importer *module) (*module, error) {
+	if vm.loader == nil {
+		return nil, vm.newError(span, "Modules are not supported here.")
+	}
+	file, err := vm.loader.Resolve(importer.file, path)
+	if err != nil {
+		return nil, vm.importError(span, path, file, err)
+	}
+	if m, ok := vm.modules[file]; ok {
+		if m.loading {
+			return nil, vm.newError(span, "Import cycle: "+vm.cycle(m)+".")
+		}
+		return m, nil
+	}
+
+	stmts, err := vm.loader.Load(file)
+	if err != nil {
+		return nil, vm.importError(span, path, file, err)
+	}
+	function, err := Compile(stmts)
+	if err != nil {
+		return nil, vm.importError(span, path, file, err)
+	}
+	m := &module{
+		name:    path,
+		file:    file,
+		globals: map[string]any{},
+		exports: map[string]bool{},
+		loading: true,
+	}
+	for _, name := range function.Exports {
+		m.exports[name] = true
+	}
+	vm.modules[file] = m
+
+	vm.importing = append(vm.importing, m)
+	frames := len(vm.frames)
+	body := &closure{function: function, module: m}
+	vm.push(body)
+	_, err = vm.invoke(body, 0, span)
+	vm.importing = vm.importing[:len(vm.importing)-1]
+	if err != nil {
+		// the error is reported at the import, so it is traced from there.
+		vm.frames = vm.frames[:frames]
+		// a failed module is not cached, so importing it again retries.
+		delete(vm.modules, file)
+		return nil, vm.importError(span, path, file, err)
+	}
+	m.loading = false
+	return m, nil
+}
+
+// cycle describes the chain of imports from m back to itself.
+func (vm *VM) cycle(m *module) string {
+	names := []string{}
+	for n := len(vm.importing) - 1; n >= 0; n-- {
+		names = append([]string{vm.importing[n].name}, names...)
+		if vm.importing[n] == m {
+			break
+		}
+	}
+	return strings.Join(append(names, m.name), " -> ")
+}
+
+// importError reports err, raised while loading file, at the import
+// statement. The positions of err are relative to file, so they are
+// listed as notes rather than rendered against the importing source.
+func (vm *VM) importError(span token.Span, name, file string, err error) error {
+	notes := []string{}
+	for _, d := range diagnostic.Flatten(err) {
+		if r, ok := err.(*runtimeError); ok {
+			// the trace of a module error points into several files.
+			d.Notes = r.notes
+		}
+		if d.Span.Start.Line == 0 {
+			notes = append(notes, d.Message)
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("%s:%s: %s", file, d.Span.Start, d.Message))
+		notes = append(notes, d.Notes...)
+	}
+	var cause error
+	if r, ok := err.(*runtimeError); ok {
+		cause = r.cause
+	}
+	return &runtimeError{
+		span:  span,
+		msg:   fmt.Sprintf("Can't import %s.", builtin.Quote(name)),
+		notes: notes,
+		trace: vm.traceback(span.Start, nil),
+		cause: cause,
+	}
+}
@@ -0,0 +1,296 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cndoit18/lox/ast"
+	"github.com/cndoit18/lox/parser"
+	"github.com/cndoit18/lox/scanner"
+)
+
+func parse(t *testing.T, src string) []ast.Stmt[any] {
+	t.Helper()
+	scan, err := scanner.NewScanner(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("NewScanner() error = %v", err)
+	}
+	stmts, err := parser.NewParser[any](scan.ScanTokens()...).Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return stmts
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		stdout string
+		want   any
+	}{
+		{
+			name: "arithmetic",
+			src:  `var a = 1; var b = 2; (a + b) * 4 - 6 / 2;`,
+			want: float64(9),
+		},
+		{
+			name: "strings",
+			src:  `"a" + 1 + nil;`,
+			want: "a1<nil>",
+		},
+		{
+			name:   "closures",
+			src:    `func counter() { var i = 0; return func () => i = i + 1; } var c = counter(); c(); print c(); print counter()();`,
+			stdout: "21",
+		},
+		{
+			name:   "closure per iteration",
+			src:    `var fs = []; for (var x in range(3)) push(fs, func () => x); for (var f in fs) print f();`,
+			stdout: "012",
+		},
+		{
+			name:   "captured loop variable",
+			src:    `var fs = []; for (var i = 0; i < 3; i = i + 1) { var j = i; push(fs, func () => j); } print fs[0]() + fs[2]();`,
+			stdout: "2",
+		},
+		{
+			name: "classes",
+			src: `
+class A { init(n) { this.n = n; } get() { return this.n; } }
+class B < A { init(n) { super.init(n * 2); } get() { return "B" + super.get(); } }
+print B(2).get(); print B(1).init(5).n;`,
+			stdout: "B410",
+		},
+		{
+			name:   "logical",
+			src:    `print nil or "x"; print 1 and 2; print false and boom;`,
+			stdout: "x2false",
+		},
+		{
+			name:   "break and continue",
+			src:    `for (var i = 0; i < 10; i = i + 1) { if (i == 1) continue; if (i == 4) break; print i; }`,
+			stdout: "023",
+		},
+		{
+			name:   "finally on return",
+			src:    `func f() { try { return "r"; } finally { print "f"; } } print f();`,
+			stdout: "fr",
+		},
+		{
+			name:   "finally on break",
+			src:    `while (true) { try { try { break; } finally { print "a"; } } finally { print "b"; } } print "c";`,
+			stdout: "abc",
+		},
+		{
+			name:   "catch runtime error",
+			src:    `func f() { return [][0]; } try { f(); } catch (e) { print e.message; } finally { print "!"; }`,
+			stdout: "List index 0 out of range for length 0.!",
+		},
+		{
+			name:   "rethrow from finally",
+			src:    `try { try { throw "x"; } finally { print "f"; } } catch (e) { print e; }`,
+			stdout: "fx",
+		},
+		{
+			name: "iterator protocol",
+			src: `
+class It { init() { this.i = 0; } hasNext() { return this.i < 2; } next() { this.i = this.i + 1; return this.i; } }
+class Seq { iterator() { return It(); } }
+for (var v in Seq()) print v;`,
+			stdout: "12",
+		},
+		{
+			name:   "maps",
+			src:    `var m = {"a": 1}; m[2] = "b"; print m; print has(m, "a");`,
+			stdout: `{"a": 1, 2: "b"}true`,
+		},
+		{
+			name:   "list containing itself",
+			src:    `var l = []; push(l, l); push(l, 1); print l;`,
+			stdout: "[[...], 1]",
+		},
+		{
+			name:   "map containing itself",
+			src:    `var m = {}; m["self"] = m; m["l"] = [m]; print str(m) + "!";`,
+			stdout: `{"self": {...}, "l": [{...}]}!`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			got, err := New(WithStdout(stdout)).Run(parse(t, tt.src))
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want = %v", got, tt.want)
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("stdout got = %q, want = %q", stdout.String(), tt.stdout)
+			}
+		})
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "top-level return",
+			src:  `return 1;`,
+			want: "1:1: error: Can't return from top-level code.",
+		},
+		{
+			name: "own initializer",
+			src:  `{ var a = a; }`,
+			want: "1:11: error: Can't read local variable in its own initializer.",
+		},
+		{
+			name: "break outside loop",
+			src:  `func f() { break; }`,
+			want: "1:12: error: Can't use 'break' outside of a loop.",
+		},
+		{
+			name: "this outside class",
+			src:  `print this;`,
+			want: "1:7: error: Can't use 'this' outside of a class.",
+		},
+		{
+			name: "initializer value",
+			src:  `class A { init() { return 1; } }`,
+			want: "1:20: error: Can't return a value from an initializer.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(parse(t, tt.src))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Compile() error = %v, want = %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "top level",
+			src:  `var a = -"a";`,
+		},
+		{
+			name: "recursive",
+			src: `func inner(n) {
+    if (n == 0) {
+        return "x" - n;
+    }
+    return inner(n - 1);
+}
+func outer() {
+    return inner(1);
+}
+outer();`,
+			want: []string{
+				"in inner() at 3:20",
+				"in inner() at 5:12",
+				"in outer() at 8:12",
+				"in script at 10:1",
+			},
+		},
+		{
+			name: "native",
+			src: `func parse(s) {
+    return num(s);
+}
+parse("a");`,
+			want: []string{
+				"in num() at 2:17",
+				"in parse() at 2:12",
+				"in script at 4:1",
+			},
+		},
+		{
+			name: "initializer",
+			src: `class Point {
+    init(x) { this.x = -x; }
+}
+Point("a");`,
+			want: []string{
+				"in Point() at 2:24",
+				"in script at 4:1",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New().Run(parse(t, tt.src))
+			runtime, ok := err.(*runtimeError)
+			if !ok {
+				t.Fatalf("Run() error = %v, want a runtime error", err)
+			}
+			got := []string{}
+			for _, frame := range runtime.Trace() {
+				got = append(got, frame.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Trace() got = %q, want = %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	src := `var a = "x";
+func f(n) {
+    return func () => n + a;
+}
+while (a) a = nil;`
+	want := `== <script> ==
+0000    1 CONSTANT            0 '"x"'
+0003    | DEFINE_GLOBAL       1 'a'
+0006    2 CLOSURE             2 <fn f>
+0009    | DEFINE_GLOBAL       3 'f'
+0012    5 GET_GLOBAL          1 'a'
+0015    | JUMP_IF_FALSE      15 -> 27
+0018    | POP
+0019    | NIL
+0020    | SET_GLOBAL          1 'a'
+0023    | POP
+0024    | LOOP               24 -> 12
+0027    | POP
+0028    | NIL
+0029    | RETURN
+
+== <fn f> ==
+0000    3 CLOSURE             0 <fn lambda>
+0003    |                     local 1
+0005    | RETURN
+0006    4 NIL
+0007    | RETURN
+
+== <fn lambda> ==
+0000    3 GET_UPVALUE         0
+0002    | GET_GLOBAL          0 'a'
+0005    | ADD
+0006    | RETURN
+0007    | NIL
+0008    | RETURN
+`
+	function, err := Compile(parse(t, src))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	got := &bytes.Buffer{}
+	Disassemble(got, function)
+	if got.String() != want {
+		t.Errorf("Disassemble() got =\n%s\nwant =\n%s", got, want)
+	}
+}